@@ -0,0 +1,79 @@
+package beam
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// ChannelsService handles communication with the channel related methods of
+// the API.
+type ChannelsService service
+
+// Get returns a channel by its ID or token.
+func (s *ChannelsService) Get(ctx context.Context, idOrToken string) (*Channel, error) {
+	var channel Channel
+	if err := s.client.get(ctx, "channels/"+idOrToken, &channel); err != nil {
+		return nil, err
+	}
+
+	return &channel, nil
+}
+
+// List returns a list of channels.
+func (s *ChannelsService) List(ctx context.Context, opts *ListOptions) ([]Channel, error) {
+	var channels []Channel
+	if err := s.client.get(ctx, withQuery("channels", opts.values()), &channels); err != nil {
+		return nil, err
+	}
+
+	return channels, nil
+}
+
+// Followers returns the users following the channel.
+func (s *ChannelsService) Followers(ctx context.Context, channelID uint, opts *ListOptions) ([]User, error) {
+	var users []User
+	path := withQuery(fmt.Sprintf("channels/%d/follow", channelID), opts.values())
+	if err := s.client.get(ctx, path, &users); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// Recordings returns the VODs of the channel.
+func (s *ChannelsService) Recordings(ctx context.Context, channelID uint, opts *ListOptions) ([]Recording, error) {
+	var recordings []Recording
+	path := withQuery(fmt.Sprintf("channels/%d/recordings", channelID), opts.values())
+	if err := s.client.get(ctx, path, &recordings); err != nil {
+		return nil, err
+	}
+
+	return recordings, nil
+}
+
+// Preferences returns the preferences of the channel.
+func (s *ChannelsService) Preferences(ctx context.Context, channelID uint) (*ChannelPreferences, error) {
+	var prefs ChannelPreferences
+	if err := s.client.get(ctx, fmt.Sprintf("channels/%d/preferences", channelID), &prefs); err != nil {
+		return nil, err
+	}
+
+	return &prefs, nil
+}
+
+// UpdatePreferences updates the preferences of the channel and returns the
+// resulting set, requires the channel:update:self scope.
+func (s *ChannelsService) UpdatePreferences(ctx context.Context, channelID uint, prefs *ChannelPreferences) (*ChannelPreferences, error) {
+	req, err := s.client.NewRequest(http.MethodPost, fmt.Sprintf("channels/%d/preferences", channelID), prefs)
+	if err != nil {
+		return nil, err
+	}
+
+	var updated ChannelPreferences
+	if _, err = s.client.Do(ctx, req, &updated); err != nil {
+		return nil, err
+	}
+
+	return &updated, nil
+}
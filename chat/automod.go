@@ -0,0 +1,567 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	ffjson "github.com/pquerna/ffjson/ffjson"
+)
+
+// Actions taken by an AutoMod, from the mildest to the harshest.
+const (
+	ActionWarn Action = iota
+	ActionDelete
+	ActionTimeout
+	ActionPurge
+)
+
+const defaultStrikeTTL = time.Hour
+
+// DefaultPenalties are the penalties of an AutoMod unless set: a warning, then
+// the message is deleted, then the user is timed out for longer and longer.
+var DefaultPenalties = []Penalty{
+	{Action: ActionWarn},
+	{Action: ActionDelete},
+	{Action: ActionTimeout, Duration: time.Minute},
+	{Action: ActionTimeout, Duration: 10 * time.Minute},
+	{Action: ActionTimeout, Duration: time.Hour},
+}
+
+var actionNames = [...]string{
+	ActionWarn:    "warn",
+	ActionDelete:  "delete",
+	ActionTimeout: "timeout",
+	ActionPurge:   "purge",
+}
+
+type (
+	// Action is what an AutoMod does to a message which breaks a rule.
+	Action int
+
+	// Penalty is an action with its duration, for timeouts.
+	Penalty struct {
+		Action   Action
+		Duration time.Duration
+	}
+
+	// Rule is a check of the chat messages.
+	Rule interface {
+		// Name returns the name of the rule, as written in the audit log.
+		Name() string
+
+		// Check returns why the message breaks the rule, or an empty string.
+		Check(msg *ChatMessage) string
+	}
+
+	// AuditEntry is an action taken by an AutoMod and why.
+	AuditEntry struct {
+		Time time.Time `json:"time"`
+
+		// The rule which was broken and how.
+		Rule   string `json:"rule"`
+		Reason string `json:"reason"`
+
+		Action   Action        `json:"action"`
+		Duration time.Duration `json:"duration,omitempty"`
+
+		// The strikes of the user, this one included.
+		Strikes int `json:"strikes"`
+
+		// The message which broke the rule.
+		Channel   uint   `json:"channel"`
+		MessageID string `json:"message_id"`
+		User      User   `json:"user"`
+		Message   string `json:"message"`
+
+		// The error of the action, if it failed.
+		Error string `json:"error,omitempty"`
+	}
+
+	// AutoMod moderates the chat messages by rules. Every message which
+	// breaks a rule is a strike of its author, and the penalty grows with the
+	// strikes: the first strike gets the first penalty, the second one the
+	// second penalty and so on, the last penalty is given from there on.
+	// It is safe for concurrent use.
+	AutoMod struct {
+		// The penalties by strike, DefaultPenalties by default.
+		Penalties []Penalty
+
+		// The time a strike counts for, forever if zero.
+		StrikeTTL time.Duration
+
+		// The lowest role which is exempt, RoleMod if unset, and the other
+		// roles which are exempt, like "ChannelEditor".
+		ExemptRole  Role
+		ExemptRoles []string
+
+		// The time an action taken by Handler may take,
+		// defaultCommandTimeout if zero.
+		Timeout time.Duration
+
+		// Audit is called with every action taken, see AuditLog.
+		Audit func(entry *AuditEntry)
+
+		mu      sync.Mutex
+		rules   []*modRule
+		strikes map[uint][]time.Time
+		swept   time.Time
+	}
+
+	modRule struct {
+		rule Rule
+		min  Penalty
+	}
+
+	// LinkRule limits the links of the messages. Hosts match their
+	// subdomains too.
+	LinkRule struct {
+		// The hosts which may be linked, any if empty.
+		Allow []string
+
+		// The hosts which may not be linked.
+		Deny []string
+	}
+
+	// CapsRule limits the share of capital letters in the messages.
+	CapsRule struct {
+		// The highest share of capitals among the letters, from 0 to 1.
+		MaxRatio float64
+
+		// The fewest letters a message needs to be checked.
+		MinLetters int
+	}
+
+	// RepeatRule limits the characters repeated in a row, like "nooooooo".
+	RepeatRule struct {
+		Max int
+	}
+
+	// PhraseRule bans the messages matching any of the patterns.
+	PhraseRule struct {
+		Patterns []*regexp.Regexp
+	}
+
+	// EmoteRule limits the emoticons of the messages.
+	EmoteRule struct {
+		Max int
+	}
+
+	// FloodRule limits the messages a user sends in a period.
+	FloodRule struct {
+		Messages int
+		Per      time.Duration
+
+		mu    sync.Mutex
+		sent  map[uint][]time.Time
+		swept time.Time
+	}
+)
+
+// NewAutoMod returns an automod with the default penalties and no rules.
+func NewAutoMod() *AutoMod {
+	return &AutoMod{
+		Penalties:  append([]Penalty(nil), DefaultPenalties...),
+		StrikeTTL:  defaultStrikeTTL,
+		ExemptRole: RoleMod,
+		Timeout:    defaultCommandTimeout,
+		strikes:    make(map[uint][]time.Time),
+	}
+}
+
+// Add adds a rule whose penalty is at least min, like ActionDelete for banned
+// phrases so they never stay in the chat. Rules are checked in the order they
+// were added and a message is only punished for the first rule it breaks.
+func (m *AutoMod) Add(rule Rule, min Penalty) {
+	m.mu.Lock()
+	m.rules = append(m.rules, &modRule{rule: rule, min: min})
+	m.mu.Unlock()
+}
+
+// Handler returns a handler of chat messages which moderates them through the
+// caller, like:
+//
+//	conn.Handle(automod.Handler(conn))
+func (m *AutoMod) Handler(caller Caller) func(*ChatMessage) {
+	return func(msg *ChatMessage) {
+		timeout := m.Timeout
+		if timeout <= 0 {
+			timeout = defaultCommandTimeout
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		m.Moderate(ctx, caller, msg)
+	}
+}
+
+// Moderate checks the message and takes the action, if any, through the
+// caller. It returns the audit entry of the action, or nil if the message
+// breaks no rule or its author is exempt.
+func (m *AutoMod) Moderate(ctx context.Context, caller Caller, msg *ChatMessage) *AuditEntry {
+	if m.exempt(&msg.User) {
+		return nil
+	}
+
+	m.mu.Lock()
+	rules := m.rules
+	m.mu.Unlock()
+
+	for _, r := range rules {
+		reason := r.rule.Check(msg)
+		if reason == "" {
+			continue
+		}
+
+		now := time.Now()
+		strikes := m.strike(msg.UserID, now)
+		penalty := m.penalty(strikes)
+		if penalty.less(r.min) {
+			penalty = r.min
+		}
+
+		entry := &AuditEntry{
+			Time:      now,
+			Rule:      r.rule.Name(),
+			Reason:    reason,
+			Action:    penalty.Action,
+			Duration:  penalty.Duration,
+			Strikes:   strikes,
+			Channel:   msg.Channel,
+			MessageID: msg.ID,
+			User:      msg.User,
+			Message:   msg.Message.PlainText(),
+		}
+		if err := punish(ctx, caller, msg, penalty, reason); err != nil {
+			entry.Error = err.Error()
+		}
+		if m.Audit != nil {
+			m.Audit(entry)
+		}
+		return entry
+	}
+
+	return nil
+}
+
+// Strikes returns the strikes of the user which still count.
+func (m *AutoMod) Strikes(userID uint) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return len(m.expire(userID, time.Now()))
+}
+
+// Forgive forgets the strikes of the user.
+func (m *AutoMod) Forgive(userID uint) {
+	m.mu.Lock()
+	delete(m.strikes, userID)
+	m.mu.Unlock()
+}
+
+func (m *AutoMod) exempt(user *User) bool {
+	min := m.ExemptRole
+	if min == RoleUnknown {
+		min = RoleMod
+	}
+	return user.Role().AtLeast(min) ||
+		len(m.ExemptRoles) > 0 && hasAnyRole(user.UserRoles, m.ExemptRoles)
+}
+
+// strike adds a strike to the user and returns the strikes which count. The
+// expired strikes of every user are dropped once per StrikeTTL.
+func (m *AutoMod) strike(userID uint, now time.Time) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.StrikeTTL > 0 && now.Sub(m.swept) >= m.StrikeTTL {
+		for id := range m.strikes {
+			m.expire(id, now)
+		}
+		m.swept = now
+	}
+	if m.strikes == nil {
+		m.strikes = make(map[uint][]time.Time)
+	}
+	strikes := append(m.expire(userID, now), now)
+	m.strikes[userID] = strikes
+	return len(strikes)
+}
+
+// expire drops the strikes of the user older than StrikeTTL.
+func (m *AutoMod) expire(userID uint, now time.Time) []time.Time {
+	strikes := m.strikes[userID]
+	for len(strikes) > 0 && m.StrikeTTL > 0 && now.Sub(strikes[0]) >= m.StrikeTTL {
+		strikes = strikes[1:]
+	}
+	if len(strikes) == 0 {
+		delete(m.strikes, userID)
+		return nil
+	}
+
+	m.strikes[userID] = strikes
+	return strikes
+}
+
+func (m *AutoMod) penalty(strikes int) Penalty {
+	if len(m.Penalties) == 0 {
+		return Penalty{Action: ActionWarn}
+	}
+	if strikes > len(m.Penalties) {
+		strikes = len(m.Penalties)
+	}
+
+	return m.Penalties[strikes-1]
+}
+
+// punish takes the action of the penalty on the message. Timeouts delete the
+// message too, the user is timed out even if the message could not be deleted.
+func punish(ctx context.Context, caller Caller, msg *ChatMessage, penalty Penalty, reason string) error {
+	switch penalty.Action {
+	case ActionWarn:
+		return caller.Call(ctx, "whisper", []interface{}{msg.UserName, "warning: " + reason}, nil)
+	case ActionDelete:
+		return caller.Call(ctx, "deleteMessage", []interface{}{msg.ID}, nil)
+	case ActionTimeout:
+		deleteErr := caller.Call(ctx, "deleteMessage", []interface{}{msg.ID}, nil)
+		err := caller.Call(ctx, "timeout", []interface{}{msg.UserName, int(penalty.Duration / time.Second)}, nil)
+		switch {
+		case deleteErr == nil:
+			return err
+		case err == nil:
+			return deleteErr
+		}
+		return fmt.Errorf("%v; %v", deleteErr, err)
+	case ActionPurge:
+		return caller.Call(ctx, "purge", []interface{}{msg.UserName}, nil)
+	}
+
+	return fmt.Errorf("chat: unknown action %v", penalty.Action)
+}
+
+func (p Penalty) less(other Penalty) bool {
+	return p.Action < other.Action || p.Action == other.Action && p.Duration < other.Duration
+}
+
+// AuditLog returns an audit function which writes the entries to w as JSON
+// lines. Write errors are dropped.
+func AuditLog(w io.Writer) func(entry *AuditEntry) {
+	var mu sync.Mutex
+	return func(entry *AuditEntry) {
+		line, err := ffjson.Marshal(entry)
+		if err != nil {
+			return
+		}
+
+		mu.Lock()
+		w.Write(append(line, '\n'))
+		mu.Unlock()
+	}
+}
+
+// String returns the name of the action.
+func (a Action) String() string {
+	if a < 0 || int(a) >= len(actionNames) {
+		return fmt.Sprintf("Action(%d)", int(a))
+	}
+
+	return actionNames[a]
+}
+
+// MarshalText implements the encoding.TextMarshaler interface.
+func (a Action) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (a *Action) UnmarshalText(text []byte) error {
+	for action, name := range actionNames {
+		if name == string(text) {
+			*a = Action(action)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("chat: unknown action %q", text)
+}
+
+// Name implements the Rule interface.
+func (r *LinkRule) Name() string { return "links" }
+
+// Check implements the Rule interface.
+func (r *LinkRule) Check(msg *ChatMessage) string {
+	for _, link := range msg.Message.Links() {
+		host := linkHost(link)
+		if matchHost(host, r.Deny) || len(r.Allow) > 0 && !matchHost(host, r.Allow) {
+			return "link to " + host + " is not allowed"
+		}
+	}
+
+	return ""
+}
+
+// Name implements the Rule interface.
+func (r *CapsRule) Name() string { return "caps" }
+
+// Check implements the Rule interface.
+func (r *CapsRule) Check(msg *ChatMessage) string {
+	var letters, caps int
+	for _, seg := range msg.Message.Message {
+		if seg.Type != SegmentText {
+			continue
+		}
+		for _, c := range seg.PlainText() {
+			if !unicode.IsLetter(c) {
+				continue
+			}
+			letters++
+			if unicode.IsUpper(c) {
+				caps++
+			}
+		}
+	}
+	if letters == 0 || letters < r.MinLetters {
+		return ""
+	}
+
+	if ratio := float64(caps) / float64(letters); ratio > r.MaxRatio {
+		return fmt.Sprintf("too many capitals (%d%%)", int(ratio*100))
+	}
+	return ""
+}
+
+// Name implements the Rule interface.
+func (r *RepeatRule) Name() string { return "repeat" }
+
+// Check implements the Rule interface.
+func (r *RepeatRule) Check(msg *ChatMessage) string {
+	var (
+		last  rune
+		count int
+	)
+	for _, c := range msg.Message.PlainText() {
+		if c == last && !unicode.IsSpace(c) {
+			count++
+		} else {
+			last, count = c, 1
+		}
+		if count > r.Max {
+			return fmt.Sprintf("%q repeated more than %d times", c, r.Max)
+		}
+	}
+
+	return ""
+}
+
+// NewPhraseRule returns a rule banning the phrases matching the patterns,
+// regardless of the case.
+func NewPhraseRule(patterns ...string) (*PhraseRule, error) {
+	r := new(PhraseRule)
+	for _, pattern := range patterns {
+		re, err := regexp.Compile("(?i)" + pattern)
+		if err != nil {
+			return nil, err
+		}
+		r.Patterns = append(r.Patterns, re)
+	}
+
+	return r, nil
+}
+
+// Name implements the Rule interface.
+func (r *PhraseRule) Name() string { return "phrases" }
+
+// Check implements the Rule interface.
+func (r *PhraseRule) Check(msg *ChatMessage) string {
+	text := msg.Message.PlainText()
+	for _, re := range r.Patterns {
+		if match := re.FindString(text); match != "" {
+			return fmt.Sprintf("banned phrase %q", match)
+		}
+	}
+
+	return ""
+}
+
+// Name implements the Rule interface.
+func (r *EmoteRule) Name() string { return "emotes" }
+
+// Check implements the Rule interface.
+func (r *EmoteRule) Check(msg *ChatMessage) string {
+	if n := len(msg.Message.Emoticons()); n > r.Max {
+		return fmt.Sprintf("too many emoticons (%d)", n)
+	}
+
+	return ""
+}
+
+// Name implements the Rule interface.
+func (r *FloodRule) Name() string { return "flood" }
+
+// Check implements the Rule interface. Every message checked counts, so the
+// rule must be checked before the rules which may stop the checks.
+func (r *FloodRule) Check(msg *ChatMessage) string {
+	now := time.Now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// The users who stopped sending are dropped once per period.
+	if now.Sub(r.swept) >= r.Per {
+		for id, sent := range r.sent {
+			if len(sent) == 0 || now.Sub(sent[len(sent)-1]) >= r.Per {
+				delete(r.sent, id)
+			}
+		}
+		r.swept = now
+	}
+	if r.sent == nil {
+		r.sent = make(map[uint][]time.Time)
+	}
+	sent := r.sent[msg.UserID]
+	for len(sent) > 0 && now.Sub(sent[0]) >= r.Per {
+		sent = sent[1:]
+	}
+	// Only the last messages over the limit matter.
+	if len(sent) > r.Messages {
+		sent = sent[len(sent)-r.Messages:]
+	}
+	sent = append(sent, now)
+	r.sent[msg.UserID] = sent
+
+	if len(sent) > r.Messages {
+		return fmt.Sprintf("more than %d messages in %s", r.Messages, r.Per)
+	}
+	return ""
+}
+
+// linkHost returns the lower case host of a link, which may have no scheme.
+func linkHost(link string) string {
+	if !strings.Contains(link, "://") {
+		link = "http://" + link
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		return strings.ToLower(link)
+	}
+
+	return strings.ToLower(u.Hostname())
+}
+
+// matchHost reports whether the host is one of the hosts or their subdomains.
+func matchHost(host string, hosts []string) bool {
+	for _, h := range hosts {
+		h = strings.ToLower(h)
+		if host == h || strings.HasSuffix(host, "."+h) {
+			return true
+		}
+	}
+
+	return false
+}
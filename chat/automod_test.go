@@ -0,0 +1,223 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAutoMod(t *testing.T) {
+	caller := new(fakeCaller)
+	phrases, err := NewPhraseRule(`free\s+skins`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var audit bytes.Buffer
+	m := NewAutoMod()
+	m.Audit = AuditLog(&audit)
+	m.ExemptRoles = []string{"ChannelEditor"}
+	m.Add(&LinkRule{Allow: []string{"mixer.com"}}, Penalty{})
+	m.Add(phrases, Penalty{Action: ActionDelete})
+
+	ctx := context.Background()
+	spam := func(user string, roles []string, text string) *AuditEntry {
+		msg := chatMessage(user, roles, text)
+		msg.ID, msg.UserID = "m-"+text, 2
+		if user != "connor" {
+			msg.UserID = 3
+		}
+		return m.Moderate(ctx, caller, msg)
+	}
+
+	assert.Nil(t, spam("connor", []string{"User"}, "hello"))
+	assert.Nil(t, spam("mod", []string{"Mod"}, "FREE SKINS"))
+	assert.Nil(t, spam("editor", []string{"User", "ChannelEditor"}, "free skins"))
+
+	// The strikes escalate: warn, delete, then timeouts.
+	var actions []Penalty
+	for _, text := range []string{"free skins", "free  skins!", "FREE SKINS", "free skins?", "free skins...", "free skins!!"} {
+		if entry := spam("connor", []string{"User"}, text); assert.NotNil(t, entry) {
+			assert.Equal(t, "phrases", entry.Rule)
+			actions = append(actions, Penalty{entry.Action, entry.Duration})
+		}
+	}
+	assert.Equal(t, []Penalty{
+		{Action: ActionDelete},
+		{Action: ActionDelete},
+		{Action: ActionTimeout, Duration: time.Minute},
+		{Action: ActionTimeout, Duration: 10 * time.Minute},
+		{Action: ActionTimeout, Duration: time.Hour},
+		{Action: ActionTimeout, Duration: time.Hour},
+	}, actions)
+	assert.Equal(t, 6, m.Strikes(2))
+	m.Forgive(2)
+	assert.Equal(t, 0, m.Strikes(2))
+
+	calls := caller.recorded()
+	if assert.Len(t, calls, 10) {
+		assert.Equal(t, call{"deleteMessage", []interface{}{"m-free skins"}, calls[0].at}, calls[0])
+		assert.Equal(t, "deleteMessage", calls[2].method)
+		assert.Equal(t, call{"timeout", []interface{}{"connor", 60}, calls[3].at}, calls[3])
+	}
+
+	// The first strike of another user is a warning.
+	msg := chatMessage("bob", []string{"User"}, "see")
+	msg.Message.Message = append(msg.Message.Message, MessageSegment{Type: SegmentLink, Text: "evil.com/x", URL: "evil.com/x"})
+	entry := m.Moderate(ctx, caller, msg)
+	if assert.NotNil(t, entry) {
+		assert.Equal(t, ActionWarn, entry.Action)
+		assert.Equal(t, "link to evil.com is not allowed", entry.Reason)
+	}
+	calls = caller.recorded()
+	assert.Equal(t, call{"whisper", []interface{}{"bob", "warning: link to evil.com is not allowed"}, calls[10].at}, calls[10])
+
+	lines := bytes.Split(bytes.TrimSpace(audit.Bytes()), []byte("\n"))
+	if assert.Len(t, lines, 7) {
+		var logged AuditEntry
+		assert.NoError(t, json.Unmarshal(lines[2], &logged))
+		assert.Equal(t, ActionTimeout, logged.Action)
+		assert.Equal(t, time.Minute, logged.Duration)
+		assert.Equal(t, 3, logged.Strikes)
+		assert.Equal(t, "connor", logged.User.UserName)
+		assert.Equal(t, "FREE SKINS", logged.Message)
+		assert.Contains(t, string(lines[2]), `"action":"timeout"`)
+	}
+}
+
+func TestAutoModError(t *testing.T) {
+	m := NewAutoMod()
+	m.Penalties = []Penalty{{Action: ActionPurge}}
+	m.Add(&RepeatRule{Max: 3}, Penalty{})
+
+	entry := m.Moderate(context.Background(), new(fakeCaller), chatMessage("fail", nil, "noooo"))
+	if assert.NotNil(t, entry) {
+		assert.Equal(t, ActionPurge, entry.Action)
+		assert.Equal(t, "failed", entry.Error)
+	}
+
+	// The user is timed out even if the message could not be deleted.
+	caller := new(fakeCaller)
+	m.Penalties = []Penalty{{Action: ActionTimeout, Duration: time.Minute}}
+	msg := chatMessage("connor", nil, "noooo")
+	msg.ID = "fail"
+	entry = m.Moderate(context.Background(), caller, msg)
+	if assert.NotNil(t, entry) {
+		assert.Equal(t, "failed", entry.Error)
+	}
+	calls := caller.recorded()
+	if assert.Len(t, calls, 2) {
+		assert.Equal(t, "timeout", calls[1].method)
+	}
+}
+
+func TestAutoModLiteral(t *testing.T) {
+	phrases, err := NewPhraseRule(`free\s+skins`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries := make(chan *AuditEntry, 1)
+	m := &AutoMod{Audit: func(entry *AuditEntry) { entries <- entry }}
+	m.Add(phrases, Penalty{Action: ActionDelete})
+
+	// Mods are exempt and the actions have the default timeout.
+	caller := new(fakeCaller)
+	assert.Nil(t, m.Moderate(context.Background(), caller, chatMessage("mod", []string{"Mod"}, "free skins")))
+	m.Handler(caller)(chatMessage("connor", []string{"User"}, "free skins"))
+	select {
+	case entry := <-entries:
+		assert.Equal(t, ActionDelete, entry.Action)
+		assert.Empty(t, entry.Error)
+	default:
+		t.Fatal("the message was not moderated")
+	}
+	if calls := caller.recorded(); assert.Len(t, calls, 1) {
+		assert.Equal(t, "deleteMessage", calls[0].method)
+	}
+}
+
+func TestAutoModSweeps(t *testing.T) {
+	m := NewAutoMod()
+	m.StrikeTTL = 20 * time.Millisecond
+	m.Add(&RepeatRule{Max: 3}, Penalty{})
+
+	// The defaults are not shared.
+	m.Penalties[0] = Penalty{Action: ActionPurge}
+	assert.Equal(t, ActionWarn, DefaultPenalties[0].Action)
+
+	caller := new(fakeCaller)
+	for id := uint(1); id <= 3; id++ {
+		msg := chatMessage("user", nil, "noooo")
+		msg.UserID = id
+		m.Moderate(context.Background(), caller, msg)
+	}
+	time.Sleep(30 * time.Millisecond)
+	msg := chatMessage("user", nil, "noooo")
+	msg.UserID = 4
+	m.Moderate(context.Background(), caller, msg)
+
+	m.mu.Lock()
+	assert.Len(t, m.strikes, 1)
+	m.mu.Unlock()
+
+	flood := &FloodRule{Messages: 2, Per: 20 * time.Millisecond}
+	for id := uint(1); id <= 3; id++ {
+		for i := 0; i < 5; i++ {
+			flood.Check(&ChatMessage{User: User{UserID: id}})
+		}
+	}
+	assert.Len(t, flood.sent[1], 3)
+	time.Sleep(30 * time.Millisecond)
+	flood.Check(&ChatMessage{User: User{UserID: 4}})
+	assert.Len(t, flood.sent, 1)
+}
+
+func TestRules(t *testing.T) {
+	emote := func(text string) MessageSegment {
+		return MessageSegment{Type: SegmentEmoticon, Text: text}
+	}
+	link := func(url string) MessageSegment {
+		return MessageSegment{Type: SegmentLink, Text: url, URL: url}
+	}
+	message := func(segs ...MessageSegment) *ChatMessage {
+		msg := &ChatMessage{User: User{UserID: 1}}
+		msg.Message.Message = segs
+		return msg
+	}
+	text := func(text string) MessageSegment {
+		return MessageSegment{Type: SegmentText, Text: text}
+	}
+
+	links := &LinkRule{Allow: []string{"mixer.com"}, Deny: []string{"bad.mixer.com"}}
+	assert.Empty(t, links.Check(message(link("https://mixer.com/a"), link("www.Mixer.com"))))
+	assert.Equal(t, "link to bad.mixer.com is not allowed", links.Check(message(link("http://bad.mixer.com"))))
+	assert.Equal(t, "link to notmixer.com is not allowed", links.Check(message(link("notmixer.com"))))
+
+	caps := &CapsRule{MaxRatio: 0.5, MinLetters: 5}
+	assert.Empty(t, caps.Check(message(text("OK"))))
+	assert.Empty(t, caps.Check(message(text("Hello World"), link("HTTP://MIXER.COM"))))
+	assert.Equal(t, "too many capitals (80%)", caps.Check(message(text("HELLo!"))))
+
+	repeat := &RepeatRule{Max: 3}
+	assert.Empty(t, repeat.Check(message(text("nooo     way"))))
+	assert.Equal(t, `'o' repeated more than 3 times`, repeat.Check(message(text("noooo"))))
+
+	emotes := &EmoteRule{Max: 2}
+	assert.Empty(t, emotes.Check(message(emote(":)"), text(" "), emote(":D"))))
+	assert.Equal(t, "too many emoticons (3)", emotes.Check(message(emote(":)"), emote(":)"), emote(":)"))))
+
+	_, err := NewPhraseRule("(")
+	assert.Error(t, err)
+
+	flood := &FloodRule{Messages: 2, Per: 50 * time.Millisecond}
+	assert.Empty(t, flood.Check(message(text("a"))))
+	assert.Empty(t, flood.Check(message(text("b"))))
+	assert.Equal(t, "more than 2 messages in 50ms", flood.Check(message(text("c"))))
+	time.Sleep(60 * time.Millisecond)
+	assert.Empty(t, flood.Check(message(text("d"))))
+}
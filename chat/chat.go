@@ -1,13 +1,24 @@
 package chat
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"sync"
+	"time"
 
 	ws "github.com/gorilla/websocket"
 	ffjson "github.com/pquerna/ffjson/ffjson"
 )
 
-const method = "method"
+const (
+	typeMethod = "method"
+	typeReply  = "reply"
+	typeEvent  = "event"
+)
+
+// ErrClosed is returned by calls made on a connection whose socket is closed.
+var ErrClosed = errors.New("chat: connection closed")
 
 type (
 	Method struct {
@@ -30,250 +41,348 @@ type (
 		Data  json.RawMessage `json:"data"`
 	}
 
-	Connection struct {
-		*ws.Conn
-	}
-)
-
-func Connect(endpoint string) (*Connection, error) {
-	var conn Connection
-	dial, _, err := ws.DefaultDialer.Dial(endpoint, nil)
-	conn.Conn = dial
-	return &conn, err
-}
+	// ReplyError is returned by a call when the server replied with an error.
+	ReplyError struct {
+		// The method which was called.
+		Method string
 
-// Auth authenticating as a User successfully.
-func (c *Connection) Auth(channelID, userID int, key string) error {
-	var args []interface{}
+		// The error sent by the server.
+		Message string
+	}
 
-	args = append(args, channelID)
+	// AuthReply is the result of a successful Auth call.
+	AuthReply struct {
+		// Indicates whether the connection is authenticated as a user.
+		Authenticated bool `json:"authenticated"`
 
-	if userID != 0 {
-		args = append(args, userID)
-	}
-	if key != "" {
-		args = append(args, key)
+		// The roles the user has in the chat.
+		Roles []string `json:"roles"`
 	}
 
-	mtd := &Method{
-		Type:      method,
-		Method:    "auth",
-		Arguments: args,
-		ID:        0,
+	// liveMessages collects the IDs of the messages received during a
+	// History call.
+	liveMessages struct {
+		ids map[string]struct{}
 	}
 
-	msg, err := ffjson.Marshal(mtd)
-	if err != nil {
-		return err
-	}
+	// Connection is a chat socket. Methods are safe for concurrent use: each
+	// call gets an unique ID and waits for the reply with the same ID, events
+	// are passed to the registered handlers. The embedded websocket must not be
+	// read or written directly.
+	Connection struct {
+		*ws.Conn
 
-	return c.Conn.WriteMessage(ws.TextMessage, msg)
-}
+		writeMu sync.Mutex
+
+		mu       sync.Mutex
+		lastID   uint
+		pending  map[uint]chan *Reply
+		handlers *registry
+		err      error
+		done     chan struct{}
+		lastPong time.Time
+		latency  latencies
+		live     []*liveMessages
 
-func (c *Connection) Msg(message string) error {
-	mtd := &Method{
-		Type:   method,
-		Method: "msg",
-		Arguments: []interface{}{
-			message,
-		},
-		ID: 2,
+		queueMu sync.Mutex
+		queue   []queued
+		wake    chan struct{}
 	}
+)
 
-	msg, err := ffjson.Marshal(mtd)
+func Connect(endpoint string) (*Connection, error) {
+	dial, _, err := ws.DefaultDialer.Dial(endpoint, nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return c.Conn.WriteMessage(ws.TextMessage, msg)
+	return NewConnection(dial), nil
 }
 
-func (c *Connection) Whisper(targetUsername, message string) error {
-	mtd := &Method{
-		Type:   method,
-		Method: "whisper",
-		Arguments: []interface{}{
-			targetUsername,
-			message,
-		},
-		ID: 2,
-	}
+// NewConnection wraps an established websocket and starts reading replies
+// and events from it.
+func NewConnection(conn *ws.Conn) *Connection {
+	c := newConnection(conn, newRegistry())
+	c.start()
 
-	msg, err := ffjson.Marshal(mtd)
-	if err != nil {
-		return err
+	return c
+}
+
+func newConnection(conn *ws.Conn, handlers *registry) *Connection {
+	c := &Connection{
+		Conn:     conn,
+		pending:  make(map[uint]chan *Reply),
+		handlers: handlers,
+		done:     make(chan struct{}),
+		wake:     make(chan struct{}, 1),
 	}
+	conn.SetPongHandler(c.pong)
 
-	return c.Conn.WriteMessage(ws.TextMessage, msg)
+	return c
 }
 
-func (c *Connection) VoteChoose(voteIndex int) error {
-	mtd := &Method{
-		Type:   method,
-		Method: "vote",
-		Arguments: []interface{}{
-			voteIndex,
-		},
-		ID: 3,
-	}
+func (c *Connection) start() {
+	go c.readLoop()
+	go c.eventLoop()
+}
 
-	msg, err := ffjson.Marshal(mtd)
-	if err != nil {
-		return err
-	}
+// Done returns a channel which is closed once the socket stops reading.
+func (c *Connection) Done() <-chan struct{} {
+	return c.done
+}
 
-	return c.Conn.WriteMessage(ws.TextMessage, msg)
+// Err returns the error which stopped the socket, if any.
+func (c *Connection) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
 }
 
-func (c *Connection) VoteStart(question string, duration int, options ...string) error {
-	mtd := &Method{
-		Type:   method,
-		Method: "vote:start",
-		Arguments: []interface{}{
-			question,
-			options,
-			duration,
-		},
-		ID: 3,
+// Call sends a method with an unique ID and waits for its reply. If result is
+// not nil, the reply data is decoded into it.
+func (c *Connection) Call(ctx context.Context, method string, args []interface{}, result interface{}) error {
+	c.mu.Lock()
+	if c.err != nil {
+		err := c.err
+		c.mu.Unlock()
+		return err
 	}
-
-	msg, err := ffjson.Marshal(mtd)
-	if err != nil {
+	c.lastID++
+	id := c.lastID
+	wait := make(chan *Reply, 1)
+	c.pending[id] = wait
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	if err := c.write(&Method{
+		Type:      typeMethod,
+		Method:    method,
+		Arguments: args,
+		ID:        id,
+	}); err != nil {
 		return err
 	}
 
-	return c.Conn.WriteMessage(ws.TextMessage, msg)
-}
-
-func (c *Connection) Timeout(username string, duration int) error {
-	mtd := &Method{
-		Type:   method,
-		Method: "timeout",
-		Arguments: []interface{}{
-			username,
-			duration,
-		},
-		ID: 4,
+	select {
+	case rpl := <-wait:
+		if rpl.Error != "" {
+			return &ReplyError{Method: method, Message: rpl.Error}
+		}
+		if result == nil || len(rpl.Data) == 0 {
+			return nil
+		}
+		return ffjson.Unmarshal(rpl.Data, result)
+	case <-c.done:
+		return c.Err()
+	case <-ctx.Done():
+		return ctx.Err()
 	}
+}
 
+func (c *Connection) write(mtd *Method) error {
 	msg, err := ffjson.Marshal(mtd)
 	if err != nil {
 		return err
 	}
 
-	return c.Conn.WriteMessage(ws.TextMessage, msg)
-}
-
-func (c *Connection) Purge(username string) error {
-	mtd := &Method{
-		Type:   method,
-		Method: "purge",
-		Arguments: []interface{}{
-			username,
-		},
-		ID: 5,
-	}
-
-	msg, err := ffjson.Marshal(mtd)
-	if err != nil {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if err := c.Conn.WriteMessage(ws.TextMessage, msg); err != nil {
 		return err
 	}
 
-	return c.Conn.WriteMessage(ws.TextMessage, msg)
+	c.handlers.tap(DirectionOut, msg)
+	return nil
 }
 
-func (c *Connection) DeleteMessage(messageID string) error {
-	mtd := &Method{
-		Type:   method,
-		Method: "deleteMessage",
-		Arguments: []interface{}{
-			messageID,
-		},
-		ID: 10,
+func (c *Connection) readLoop() {
+	var err error
+	for {
+		var msg []byte
+		if _, msg, err = c.Conn.ReadMessage(); err != nil {
+			break
+		}
+
+		c.handlers.tap(DirectionIn, msg)
+		c.dispatch(msg)
 	}
 
-	msg, err := ffjson.Marshal(mtd)
-	if err != nil {
-		return err
+	c.mu.Lock()
+	if c.err == nil {
+		c.err = ErrClosed
+		if !ws.IsCloseError(err, ws.CloseNormalClosure) {
+			c.err = err
+		}
 	}
+	c.mu.Unlock()
+	close(c.done)
+}
 
-	return c.Conn.WriteMessage(ws.TextMessage, msg)
+// dispatch routes an incoming frame. Frames which can not be decoded are
+// dropped.
+func (c *Connection) dispatch(msg []byte) {
+	var head struct {
+		Type string `json:"type"`
+	}
+	if err := ffjson.Unmarshal(msg, &head); err != nil {
+		return
+	}
+
+	switch head.Type {
+	case typeReply:
+		var rpl Reply
+		if err := ffjson.Unmarshal(msg, &rpl); err != nil {
+			return
+		}
+
+		c.mu.Lock()
+		wait, ok := c.pending[rpl.ID]
+		c.mu.Unlock()
+		if !ok {
+			return
+		}
+
+		select {
+		case wait <- &rpl:
+		default:
+		}
+	case typeEvent:
+		var evt Event
+		if err := ffjson.Unmarshal(msg, &evt); err != nil {
+			return
+		}
+
+		c.enqueue(&evt)
+	}
 }
 
-func (c *Connection) ClearMessages() error {
-	mtd := &Method{
-		Type:   method,
-		Method: "clearMessages",
-		ID:     11,
+// Error implements the error interface.
+func (e *ReplyError) Error() string {
+	return "chat: " + e.Method + ": " + e.Message
+}
+
+// Auth authenticating as a User successfully.
+func (c *Connection) Auth(ctx context.Context, channelID, userID int, key string) (*AuthReply, error) {
+	var args []interface{}
+
+	args = append(args, channelID)
+
+	if userID != 0 {
+		args = append(args, userID)
+	}
+	if key != "" {
+		args = append(args, key)
 	}
 
-	msg, err := ffjson.Marshal(mtd)
-	if err != nil {
-		return err
+	var rpl AuthReply
+	if err := c.Call(ctx, "auth", args, &rpl); err != nil {
+		return nil, err
 	}
 
-	return c.Conn.WriteMessage(ws.TextMessage, msg)
+	return &rpl, nil
 }
 
-func (c *Connection) History(limit int) error {
-	mtd := &Method{
-		Type:   method,
-		Method: "history",
-		Arguments: []interface{}{
-			limit,
-		},
-		ID: 1,
+// Msg sends a message to the chat and returns it as parsed by the server.
+func (c *Connection) Msg(ctx context.Context, message string) (*ChatMessage, error) {
+	var msg ChatMessage
+	if err := c.Call(ctx, "msg", []interface{}{message}, &msg); err != nil {
+		return nil, err
 	}
 
-	msg, err := ffjson.Marshal(mtd)
-	if err != nil {
-		return err
+	return &msg, nil
+}
+
+// Whisper sends a message to the user and returns it as parsed by the server.
+func (c *Connection) Whisper(ctx context.Context, targetUsername, message string) (*ChatMessage, error) {
+	var msg ChatMessage
+	if err := c.Call(ctx, "whisper", []interface{}{targetUsername, message}, &msg); err != nil {
+		return nil, err
 	}
 
-	return c.Conn.WriteMessage(ws.TextMessage, msg)
+	return &msg, nil
 }
 
-func (c *Connection) Giveaway() error {
-	mtd := &Method{
-		Type:   method,
-		Method: "giveaway:start",
-		ID:     11,
-	}
+func (c *Connection) VoteChoose(ctx context.Context, voteIndex int) error {
+	return c.Call(ctx, "vote:choose", []interface{}{voteIndex}, nil)
+}
 
-	msg, err := ffjson.Marshal(mtd)
-	if err != nil {
-		return err
-	}
+func (c *Connection) VoteStart(ctx context.Context, question string, duration int, options ...string) error {
+	return c.Call(ctx, "vote:start", []interface{}{question, options, duration}, nil)
+}
 
-	return c.Conn.WriteMessage(ws.TextMessage, msg)
+func (c *Connection) Timeout(ctx context.Context, username string, duration int) error {
+	return c.Call(ctx, "timeout", []interface{}{username, duration}, nil)
 }
 
-func (c *Connection) Ping() error {
-	mtd := &Method{
-		Type:   method,
-		Method: "ping",
-		ID:     12,
-	}
+func (c *Connection) Purge(ctx context.Context, username string) error {
+	return c.Call(ctx, "purge", []interface{}{username}, nil)
+}
 
-	msg, err := ffjson.Marshal(mtd)
-	if err != nil {
-		return err
-	}
+func (c *Connection) DeleteMessage(ctx context.Context, messageID string) error {
+	return c.Call(ctx, "deleteMessage", []interface{}{messageID}, nil)
+}
 
-	return c.Conn.WriteMessage(ws.TextMessage, msg)
+func (c *Connection) ClearMessages(ctx context.Context) error {
+	return c.Call(ctx, "clearMessages", nil, nil)
 }
 
-func (c *Connection) AttachEmotes() error {
-	mtd := &Method{
-		Type:   method,
-		Method: "attachEmotes",
-		ID:     12,
-	}
+// History returns the last messages of the chat, up to limit, the oldest
+// first. The messages received as events while waiting for the reply are left
+// out, so they are not handled twice.
+func (c *Connection) History(ctx context.Context, limit int) ([]*ChatMessage, error) {
+	live := &liveMessages{ids: make(map[string]struct{})}
+
+	c.mu.Lock()
+	c.live = append(c.live, live)
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		for i := range c.live {
+			if c.live[i] == live {
+				c.live = append(c.live[:i:i], c.live[i+1:]...)
+				return
+			}
+		}
+	}()
+
+	var history []*ChatMessage
+	if err := c.Call(ctx, "history", []interface{}{limit}, &history); err != nil {
+		return nil, err
+	}
+
+	// The reply is dispatched after the events read before it, so every
+	// message sent while waiting is known by now.
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	messages := history[:0]
+	for _, msg := range history {
+		if msg == nil {
+			continue
+		}
+		if _, ok := live.ids[msg.ID]; !ok {
+			messages = append(messages, msg)
+		}
+	}
+	return messages, nil
+}
 
-	msg, err := ffjson.Marshal(mtd)
-	if err != nil {
-		return err
-	}
+func (c *Connection) Giveaway(ctx context.Context) error {
+	return c.Call(ctx, "giveaway:start", nil, nil)
+}
+
+func (c *Connection) Ping(ctx context.Context) error {
+	return c.Call(ctx, "ping", nil, nil)
+}
 
-	return c.Conn.WriteMessage(ws.TextMessage, msg)
+func (c *Connection) AttachEmotes(ctx context.Context) error {
+	return c.Call(ctx, "attachEmotes", nil, nil)
 }
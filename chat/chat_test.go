@@ -0,0 +1,169 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	ws "github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+// serve starts a websocket server which hands every accepted socket to fn.
+func serve(fn func(*ws.Conn)) *httptest.Server {
+	upgrader := ws.Upgrader{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		fn(conn)
+	}))
+}
+
+func dial(t *testing.T, srv *httptest.Server) *Connection {
+	conn, err := Connect("ws" + strings.TrimPrefix(srv.URL, "http"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func TestCallCorrelatesReplies(t *testing.T) {
+	const calls = 8
+
+	// Replies are sent in reverse order once every call has arrived.
+	srv := serve(func(conn *ws.Conn) {
+		var methods []Method
+		for len(methods) < calls {
+			var mtd Method
+			if err := conn.ReadJSON(&mtd); err != nil {
+				return
+			}
+			methods = append(methods, mtd)
+		}
+		for i := len(methods) - 1; i >= 0; i-- {
+			data, _ := json.Marshal(methods[i].Arguments[0])
+			conn.WriteJSON(&Reply{Type: typeReply, ID: methods[i].ID, Data: data})
+		}
+		conn.ReadMessage()
+	})
+	defer srv.Close()
+
+	conn := dial(t, srv)
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for i := 0; i < calls; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var result string
+			err := conn.Call(ctx, "msg", []interface{}{fmt.Sprint("message ", i)}, &result)
+			assert.NoError(t, err)
+			assert.Equal(t, fmt.Sprint("message ", i), result)
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestCallReplyError(t *testing.T) {
+	srv := serve(func(conn *ws.Conn) {
+		var mtd Method
+		if err := conn.ReadJSON(&mtd); err != nil {
+			return
+		}
+		conn.WriteJSON(&Reply{Type: typeReply, ID: mtd.ID, Error: "UACCESS"})
+		conn.ReadMessage()
+	})
+	defer srv.Close()
+
+	conn := dial(t, srv)
+	defer conn.Close()
+
+	err := conn.Timeout(context.Background(), "connor", 60)
+	if assert.IsType(t, &ReplyError{}, err) {
+		assert.Equal(t, "timeout", err.(*ReplyError).Method)
+		assert.Equal(t, "UACCESS", err.(*ReplyError).Message)
+	}
+}
+
+func TestCallContextDeadline(t *testing.T) {
+	srv := serve(func(conn *ws.Conn) {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})
+	defer srv.Close()
+
+	conn := dial(t, srv)
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	assert.Equal(t, context.DeadlineExceeded, conn.Ping(ctx))
+}
+
+func TestHistory(t *testing.T) {
+	// A message arrives while the history is requested, so the server
+	// returns it both ways.
+	srv := serve(func(conn *ws.Conn) {
+		var mtd Method
+		if err := conn.ReadJSON(&mtd); err != nil {
+			return
+		}
+		assert.Equal(t, "history", mtd.Method)
+		assert.Equal(t, []interface{}{float64(50)}, mtd.Arguments)
+
+		message := func(id, text string) string {
+			return `{"channel":5,"id":"` + id + `","user_name":"connor","user_id":2,"user_roles":["Mod","User"],"message":{"message":[{"type":"text","data":"` + text + `","text":"` + text + `"}],"meta":{}}}`
+		}
+		conn.WriteJSON(&Event{Type: typeEvent, Event: EventChatMessage, Data: json.RawMessage(message("m3", "third"))})
+		conn.WriteJSON(&Reply{
+			Type: typeReply,
+			ID:   mtd.ID,
+			Data: json.RawMessage(`[` + message("m1", "first") + `,` + message("m2", "second") + `,` + message("m3", "third") + `]`),
+		})
+		conn.ReadMessage()
+	})
+	defer srv.Close()
+
+	conn := dial(t, srv)
+	defer conn.Close()
+
+	live := make(chan *ChatMessage, 1)
+	conn.Handle(func(msg *ChatMessage) { live <- msg })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	history, err := conn.History(ctx, 50)
+	assert.NoError(t, err)
+	if assert.Len(t, history, 2) {
+		assert.Equal(t, "m1", history[0].ID)
+		assert.Equal(t, "first", history[0].Message.PlainText())
+		assert.Equal(t, "connor", history[0].UserName)
+		assert.Equal(t, RoleMod, history[0].Role())
+		assert.Equal(t, "m2", history[1].ID)
+	}
+
+	select {
+	case msg := <-live:
+		assert.Equal(t, "m3", msg.ID)
+	case <-ctx.Done():
+		t.Fatal("the live message was not handled")
+	}
+}
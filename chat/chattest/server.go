@@ -0,0 +1,667 @@
+// Package chattest provides a chat server for testing code built on chat
+// connections, like net/http/httptest does for HTTP handlers.
+package chattest // gitlab.com/toby3d/mixer/chat/chattest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	ws "github.com/gorilla/websocket"
+	ffjson "github.com/pquerna/ffjson/ffjson"
+	"gitlab.com/toby3d/mixer/chat"
+)
+
+// Errors replied by the server, as sent by the real one.
+const (
+	ErrUnknownMethod    = "UNKNOWN_METHOD_NAME"
+	ErrNotAuthenticated = "You must be authenticated to do that."
+	ErrPermission       = "You don't have permission to do that."
+	ErrBadArguments     = "Invalid arguments."
+	ErrMessageNotFound  = "Message not found."
+	ErrPollRunning      = "A poll is already in progress."
+	ErrNoPoll           = "There is no poll in progress."
+	ErrAlreadyVoted     = "You have already voted."
+)
+
+// MaxHistory is the most messages kept and returned by the history method.
+const MaxHistory = 100
+
+type (
+	// HandlerFunc answers a method in place of the server. The result is sent
+	// as the reply data, the error as the reply error.
+	HandlerFunc func(call *Call) (interface{}, error)
+
+	// Call is a method sent by a client.
+	Call struct {
+		Method    string
+		Arguments []interface{}
+		ID        uint
+
+		// The user the connection is authenticated as, zero if anonymous.
+		User chat.User
+	}
+
+	// Server is a chat server on the loopback interface. It keeps the
+	// messages, the users who authenticated and a poll, answers the methods
+	// of the chat protocol and records every call.
+	Server struct {
+		// The websocket URL of the server, like "ws://127.0.0.1:1234".
+		URL string
+
+		// The channel the clients authenticate in.
+		ChannelID uint
+
+		srv *httptest.Server
+
+		mu       sync.Mutex
+		users    map[uint]*account
+		sessions map[*session]struct{}
+		handlers map[string]HandlerFunc
+		calls    []*Call
+		called   chan struct{}
+		history  []*chat.ChatMessage
+		lastID   int
+		poll     *chat.Poll
+		voted    map[uint]bool
+		endPoll  *time.Timer
+	}
+
+	account struct {
+		user chat.User
+		key  string
+	}
+
+	session struct {
+		srv     *Server
+		conn    *ws.Conn
+		writeMu sync.Mutex
+
+		// Guarded by the server.
+		user   chat.User
+		authed bool
+	}
+)
+
+// NewServer starts a server of the channel. Close it when done.
+func NewServer(channelID uint) *Server {
+	s := &Server{
+		ChannelID: channelID,
+		users:     make(map[uint]*account),
+		sessions:  make(map[*session]struct{}),
+		handlers:  make(map[string]HandlerFunc),
+		called:    make(chan struct{}),
+		voted:     make(map[uint]bool),
+	}
+	s.srv = httptest.NewServer(http.HandlerFunc(s.serve))
+	s.URL = "ws" + strings.TrimPrefix(s.srv.URL, "http")
+
+	return s
+}
+
+// Close disconnects the clients and stops the server.
+func (s *Server) Close() {
+	s.Disconnect()
+
+	s.mu.Lock()
+	if s.endPoll != nil {
+		s.endPoll.Stop()
+	}
+	s.mu.Unlock()
+
+	s.srv.Close()
+}
+
+// Disconnect closes the connection of every client, which may connect again.
+func (s *Server) Disconnect() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for sess := range s.sessions {
+		sess.conn.Close()
+	}
+}
+
+// AddUser registers a user who may authenticate with the key.
+func (s *Server) AddUser(userID uint, userName, key string, roles ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(roles) == 0 {
+		roles = []string{chat.RoleUser.String()}
+	}
+	s.users[userID] = &account{
+		user: chat.User{UserName: userName, UserID: userID, UserRoles: roles},
+		key:  key,
+	}
+}
+
+// Handle answers the method with fn in place of the server, like to fail it.
+func (s *Server) Handle(method string, fn HandlerFunc) {
+	s.mu.Lock()
+	s.handlers[method] = fn
+	s.mu.Unlock()
+}
+
+// Emit sends an event to every client, data is encoded as the event data.
+func (s *Server) Emit(event string, data interface{}) error {
+	raw, err := ffjson.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.broadcast(&chat.Event{Type: "event", Event: event, Data: raw})
+	return nil
+}
+
+// Say sends a message to the chat as the user and returns it.
+func (s *Server) Say(user chat.User, text string) *chat.ChatMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	msg := s.message(user, text, "")
+	s.remember(msg)
+	s.emit(chat.EventChatMessage, msg)
+
+	return msg
+}
+
+// History returns the messages kept by the server, the oldest first.
+func (s *Server) History() []*chat.ChatMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]*chat.ChatMessage(nil), s.history...)
+}
+
+// Poll returns a copy of the running poll.
+func (s *Server) Poll() (*chat.Poll, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.poll == nil {
+		return nil, false
+	}
+	poll := *s.poll
+	poll.Answers = append([]string(nil), s.poll.Answers...)
+	poll.Author.UserRoles = append([]string(nil), s.poll.Author.UserRoles...)
+	poll.Responses = make(map[string]int, len(s.poll.Responses))
+	for answer, votes := range s.poll.Responses {
+		poll.Responses[answer] = votes
+	}
+	return &poll, true
+}
+
+// EndPoll ends the running poll now.
+func (s *Server) EndPoll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.finishPoll(s.poll)
+}
+
+// Calls returns the recorded calls of the methods, or every call if none is
+// given, in the order they arrived.
+func (s *Server) Calls(methods ...string) []*Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return filterCalls(s.calls, methods)
+}
+
+// WaitCalls waits for n calls of the method and returns them.
+func (s *Server) WaitCalls(ctx context.Context, method string, n int) ([]*Call, error) {
+	for {
+		s.mu.Lock()
+		calls := filterCalls(s.calls, []string{method})
+		called := s.called
+		s.mu.Unlock()
+		if len(calls) >= n {
+			return calls, nil
+		}
+
+		select {
+		case <-called:
+		case <-ctx.Done():
+			return calls, ctx.Err()
+		}
+	}
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	upgrader := ws.Upgrader{}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	sess := &session{srv: s, conn: conn}
+	s.mu.Lock()
+	s.sessions[sess] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.sessions, sess)
+		s.mu.Unlock()
+	}()
+
+	sess.send(&chat.Event{Type: "event", Event: chat.EventWelcome, Data: []byte(`{"server":"chattest"}`)})
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		var mtd chat.Method
+		if err := ffjson.Unmarshal(data, &mtd); err != nil || mtd.Type != "method" {
+			continue
+		}
+		sess.answer(&mtd)
+	}
+}
+
+// answer records a call and replies to it.
+func (sess *session) answer(mtd *chat.Method) {
+	s := sess.srv
+
+	s.mu.Lock()
+	call := &Call{Method: mtd.Method, Arguments: mtd.Arguments, ID: mtd.ID, User: sess.user}
+	s.calls = append(s.calls, call)
+	close(s.called)
+	s.called = make(chan struct{})
+	fn := s.handlers[mtd.Method]
+	s.mu.Unlock()
+
+	// Custom handlers run without the lock, so they may use the server.
+	var (
+		result interface{}
+		err    error
+	)
+	if fn != nil {
+		result, err = fn(call)
+	} else {
+		s.mu.Lock()
+		result, err = sess.call(call)
+		s.mu.Unlock()
+	}
+
+	rpl := &chat.Reply{Type: "reply", ID: mtd.ID}
+	if err != nil {
+		rpl.Error = err.Error()
+	} else if rpl.Data, err = ffjson.Marshal(result); err != nil {
+		rpl.Error = err.Error()
+	}
+	sess.send(rpl)
+}
+
+// call runs a method, with the lock of the server held.
+func (sess *session) call(call *Call) (interface{}, error) {
+	s := sess.srv
+	args := call.Arguments
+
+	if call.Method != "auth" && call.Method != "ping" && call.Method != "history" {
+		if !sess.authed {
+			return nil, errors.New(ErrNotAuthenticated)
+		}
+		if !chat.HighestRole(sess.user.UserRoles).Can(call.Method) {
+			return nil, errors.New(ErrPermission)
+		}
+	}
+
+	switch call.Method {
+	case "auth":
+		if len(args) < 1 || uintArg(args[0]) != s.ChannelID {
+			return nil, errors.New(ErrBadArguments)
+		}
+		sess.authed, sess.user = false, chat.User{}
+		if len(args) == 3 {
+			if acc, ok := s.users[uintArg(args[1])]; ok && acc.key == args[2] {
+				sess.authed, sess.user = true, acc.user
+			}
+		}
+		return &chat.AuthReply{
+			Authenticated: sess.authed,
+			Roles:         append([]string{}, sess.user.UserRoles...),
+		}, nil
+	case "msg":
+		text, ok := stringArg(args, 0)
+		if !ok {
+			return nil, errors.New(ErrBadArguments)
+		}
+		msg := s.message(sess.user, text, "")
+		s.remember(msg)
+		s.emit(chat.EventChatMessage, msg)
+		return msg, nil
+	case "whisper":
+		target, ok := stringArg(args, 0)
+		text, ok2 := stringArg(args, 1)
+		if !ok || !ok2 {
+			return nil, errors.New(ErrBadArguments)
+		}
+		msg := s.message(sess.user, text, target)
+		for other := range s.sessions {
+			if other == sess || other.user.UserName == target {
+				other.sendEvent(chat.EventChatMessage, msg)
+			}
+		}
+		return msg, nil
+	case "timeout":
+		name, ok := stringArg(args, 0)
+		if !ok || len(args) < 2 {
+			return nil, errors.New(ErrBadArguments)
+		}
+		d, err := durationArg(args[1])
+		if err != nil {
+			return nil, errors.New(ErrBadArguments)
+		}
+		s.emit(chat.EventUserTimeout, &chat.UserTimeout{User: s.user(name), Duration: int64(d / time.Millisecond)})
+		return fmt.Sprintf("%s has been timed out for %s.", name, d), nil
+	case "purge":
+		name, ok := stringArg(args, 0)
+		if !ok {
+			return nil, errors.New(ErrBadArguments)
+		}
+		user := s.user(name)
+		s.forget(func(msg *chat.ChatMessage) bool { return msg.UserName == name })
+		s.emit(chat.EventPurgeMessage, &chat.PurgeMessage{UserID: user.UserID, Moderator: sess.user})
+		return nil, nil
+	case "deleteMessage":
+		id, ok := stringArg(args, 0)
+		if !ok {
+			return nil, errors.New(ErrBadArguments)
+		}
+		if !s.forget(func(msg *chat.ChatMessage) bool { return msg.ID == id }) {
+			return nil, errors.New(ErrMessageNotFound)
+		}
+		s.emit(chat.EventDeleteMessage, &chat.DeleteMessage{ID: id, Moderator: sess.user})
+		return "Message deleted.", nil
+	case "clearMessages":
+		s.history = nil
+		s.emit(chat.EventClearMessages, &chat.ClearMessages{Clearer: sess.user})
+		return nil, nil
+	case "history":
+		limit := MaxHistory
+		if len(args) > 0 {
+			if n := int(uintArg(args[0])); n < limit {
+				limit = n
+			}
+		}
+		history := s.history
+		if len(history) > limit {
+			history = history[len(history)-limit:]
+		}
+		return append([]*chat.ChatMessage{}, history...), nil
+	case "vote:start":
+		return s.startPoll(sess.user, args)
+	case "vote:choose":
+		return s.vote(sess.user, args)
+	case "giveaway:start":
+		return nil, nil
+	case "ping":
+		return nil, nil
+	}
+
+	return nil, errors.New(ErrUnknownMethod)
+}
+
+func (s *Server) startPoll(author chat.User, args []interface{}) (interface{}, error) {
+	question, ok := stringArg(args, 0)
+	if !ok || len(args) < 3 {
+		return nil, errors.New(ErrBadArguments)
+	}
+	list, ok := args[1].([]interface{})
+	if !ok || len(list) < 2 {
+		return nil, errors.New(ErrBadArguments)
+	}
+	seconds, ok := args[2].(float64)
+	if !ok || seconds <= 0 {
+		return nil, errors.New(ErrBadArguments)
+	}
+	if s.poll != nil {
+		return nil, errors.New(ErrPollRunning)
+	}
+
+	answers := make([]string, len(list))
+	responses := make(map[string]int, len(list))
+	for i, answer := range list {
+		text, ok := answer.(string)
+		if !ok {
+			return nil, errors.New(ErrBadArguments)
+		}
+		answers[i] = text
+		responses[text] = 0
+	}
+
+	duration := time.Duration(seconds * float64(time.Second))
+	poll := &chat.Poll{
+		OriginatingChannel: s.ChannelID,
+		Question:           question,
+		Answers:            answers,
+		Author:             author,
+		Duration:           int64(duration / time.Millisecond),
+		EndsAt:             time.Now().Add(duration).UnixNano() / int64(time.Millisecond),
+		Responses:          responses,
+	}
+	s.poll = poll
+	s.voted = make(map[uint]bool)
+	s.endPoll = time.AfterFunc(duration, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		s.finishPoll(poll)
+	})
+	s.emit(chat.EventPollStart, &chat.PollStart{Poll: *poll})
+
+	return true, nil
+}
+
+func (s *Server) vote(user chat.User, args []interface{}) (interface{}, error) {
+	if s.poll == nil {
+		return nil, errors.New(ErrNoPoll)
+	}
+	if len(args) < 1 {
+		return nil, errors.New(ErrBadArguments)
+	}
+	index, ok := args[0].(float64)
+	if !ok || index < 0 || int(index) >= len(s.poll.Answers) {
+		return nil, errors.New(ErrBadArguments)
+	}
+	if s.voted[user.UserID] {
+		return nil, errors.New(ErrAlreadyVoted)
+	}
+
+	s.voted[user.UserID] = true
+	s.poll.Voters++
+	s.poll.Responses[s.poll.Answers[int(index)]]++
+	s.emit(chat.EventPollStart, &chat.PollStart{Poll: *s.poll})
+
+	return true, nil
+}
+
+// finishPoll ends the poll if it still runs.
+func (s *Server) finishPoll(poll *chat.Poll) {
+	if poll == nil || s.poll != poll {
+		return
+	}
+
+	s.endPoll.Stop()
+	s.poll = nil
+	s.emit(chat.EventPollEnd, &chat.PollEnd{Poll: *poll})
+}
+
+// message returns a new message of the user, split in segments like the real
+// server does.
+func (s *Server) message(user chat.User, text, target string) *chat.ChatMessage {
+	s.lastID++
+	msg := &chat.ChatMessage{
+		Channel: s.ChannelID,
+		ID:      fmt.Sprintf("00000000-0000-4000-8000-%012d", s.lastID),
+		User:    user,
+		Target:  target,
+	}
+	if strings.HasPrefix(text, "/me ") {
+		text = strings.TrimPrefix(text, "/me ")
+		msg.Message.Meta.Me = true
+	}
+	msg.Message.Meta.Whisper = target != ""
+	msg.Message.Message = segments(text)
+
+	return msg
+}
+
+func (s *Server) remember(msg *chat.ChatMessage) {
+	s.history = append(s.history, msg)
+	if len(s.history) > MaxHistory {
+		s.history = s.history[len(s.history)-MaxHistory:]
+	}
+}
+
+// forget removes the messages matching fn from the history and reports
+// whether there were any.
+func (s *Server) forget(fn func(*chat.ChatMessage) bool) bool {
+	var kept []*chat.ChatMessage
+	for _, msg := range s.history {
+		if !fn(msg) {
+			kept = append(kept, msg)
+		}
+	}
+	found := len(kept) != len(s.history)
+	s.history = kept
+
+	return found
+}
+
+// user returns a registered user by name, or a user with the name only.
+func (s *Server) user(name string) chat.User {
+	name = strings.TrimPrefix(name, "@")
+	for _, acc := range s.users {
+		if strings.EqualFold(acc.user.UserName, name) {
+			return acc.user
+		}
+	}
+
+	return chat.User{UserName: name}
+}
+
+// emit sends an event to every client, with the lock held.
+func (s *Server) emit(event string, data interface{}) {
+	raw, err := ffjson.Marshal(data)
+	if err != nil {
+		return
+	}
+	s.broadcast(&chat.Event{Type: "event", Event: event, Data: raw})
+}
+
+func (s *Server) broadcast(evt *chat.Event) {
+	for sess := range s.sessions {
+		sess.send(evt)
+	}
+}
+
+func (sess *session) sendEvent(event string, data interface{}) {
+	raw, err := ffjson.Marshal(data)
+	if err != nil {
+		return
+	}
+	sess.send(&chat.Event{Type: "event", Event: event, Data: raw})
+}
+
+func (sess *session) send(frame interface{}) {
+	data, err := ffjson.Marshal(frame)
+	if err != nil {
+		return
+	}
+
+	sess.writeMu.Lock()
+	defer sess.writeMu.Unlock()
+	sess.conn.WriteMessage(ws.TextMessage, data)
+}
+
+// segments splits a message in text, tag and link segments.
+func segments(text string) []chat.MessageSegment {
+	var (
+		segs  []chat.MessageSegment
+		plain string
+	)
+	flush := func() {
+		if plain != "" {
+			segs = append(segs, chat.MessageSegment{Type: chat.SegmentText, Text: plain, Data: plain})
+			plain = ""
+		}
+	}
+
+	for i, word := range strings.Split(text, " ") {
+		if i > 0 {
+			plain += " "
+		}
+
+		switch {
+		case len(word) > 1 && word[0] == '@':
+			flush()
+			segs = append(segs, chat.MessageSegment{Type: chat.SegmentTag, Text: word, UserName: word[1:]})
+		case strings.HasPrefix(word, "http://") || strings.HasPrefix(word, "https://"):
+			flush()
+			segs = append(segs, chat.MessageSegment{Type: chat.SegmentLink, Text: word, URL: word})
+		default:
+			plain += word
+		}
+	}
+	flush()
+
+	return segs
+}
+
+func stringArg(args []interface{}, i int) (string, bool) {
+	if i >= len(args) {
+		return "", false
+	}
+	text, ok := args[i].(string)
+	return text, ok
+}
+
+func uintArg(arg interface{}) uint {
+	if n, ok := arg.(float64); ok && n > 0 {
+		return uint(n)
+	}
+	return 0
+}
+
+// durationArg parses a timeout duration, either seconds or a string like "5m".
+func durationArg(arg interface{}) (time.Duration, error) {
+	switch arg := arg.(type) {
+	case float64:
+		return time.Duration(arg * float64(time.Second)), nil
+	case string:
+		return time.ParseDuration(arg)
+	}
+
+	return 0, errors.New("chattest: invalid duration")
+}
+
+func filterCalls(calls []*Call, methods []string) []*Call {
+	var list []*Call
+	for _, call := range calls {
+		if len(methods) == 0 {
+			list = append(list, call)
+			continue
+		}
+		for _, method := range methods {
+			if call.Method == method {
+				list = append(list, call)
+				break
+			}
+		}
+	}
+
+	return list
+}
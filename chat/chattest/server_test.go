@@ -0,0 +1,178 @@
+package chattest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/toby3d/mixer/chat"
+)
+
+func connect(t *testing.T, srv *Server) (*chat.Connection, chan interface{}) {
+	conn, err := chat.Connect(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := make(chan interface{}, 16)
+	conn.Notify(events)
+
+	return conn, events
+}
+
+// next returns the next event which is not the welcome.
+func next(t *testing.T, events chan interface{}) interface{} {
+	for {
+		select {
+		case evt := <-events:
+			if _, ok := evt.(*chat.Welcome); !ok {
+				return evt
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("no event")
+			return nil
+		}
+	}
+}
+
+func TestServer(t *testing.T) {
+	srv := NewServer(5)
+	defer srv.Close()
+	srv.AddUser(1, "bot", "key", "Mod")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn, events := connect(t, srv)
+	defer conn.Close()
+
+	auth, err := conn.Auth(ctx, 5, 1, "key")
+	if assert.NoError(t, err) {
+		assert.True(t, auth.Authenticated)
+		assert.Equal(t, chat.RoleMod, auth.Role())
+	}
+
+	msg, err := conn.Msg(ctx, "hi @connor see https://mixer.com")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "bot", msg.UserName)
+		assert.Equal(t, uint(5), msg.Channel)
+		assert.Equal(t, "hi @connor see https://mixer.com", msg.Message.PlainText())
+		assert.Equal(t, []string{"connor"}, msg.Message.Mentions())
+		assert.Equal(t, []string{"https://mixer.com"}, msg.Message.Links())
+	}
+	if evt, ok := next(t, events).(*chat.ChatMessage); assert.True(t, ok) {
+		assert.Equal(t, msg.ID, evt.ID)
+	}
+
+	said := srv.Say(chat.User{UserName: "connor", UserID: 2}, "hello")
+	if evt, ok := next(t, events).(*chat.ChatMessage); assert.True(t, ok) {
+		assert.Equal(t, said.ID, evt.ID)
+	}
+
+	var history []*chat.ChatMessage
+	assert.NoError(t, conn.Call(ctx, "history", []interface{}{1}, &history))
+	if assert.Len(t, history, 1) {
+		assert.Equal(t, "hello", history[0].Message.PlainText())
+	}
+
+	assert.NoError(t, conn.Timeout(ctx, "connor", 60))
+	if evt, ok := next(t, events).(*chat.UserTimeout); assert.True(t, ok) {
+		assert.Equal(t, "connor", evt.User.UserName)
+		assert.Equal(t, int64(60000), evt.Duration)
+	}
+
+	assert.NoError(t, conn.DeleteMessage(ctx, said.ID))
+	if evt, ok := next(t, events).(*chat.DeleteMessage); assert.True(t, ok) {
+		assert.Equal(t, said.ID, evt.ID)
+		assert.Equal(t, "bot", evt.Moderator.UserName)
+	}
+	assert.Equal(t, &chat.ReplyError{Method: "deleteMessage", Message: ErrMessageNotFound}, conn.DeleteMessage(ctx, said.ID))
+	assert.Len(t, srv.History(), 1)
+
+	calls := srv.Calls("msg", "timeout")
+	if assert.Len(t, calls, 2) {
+		assert.Equal(t, "msg", calls[0].Method)
+		assert.Equal(t, []interface{}{"connor", float64(60)}, calls[1].Arguments)
+		assert.Equal(t, "bot", calls[1].User.UserName)
+	}
+
+	srv.Handle("ping", func(call *Call) (interface{}, error) {
+		return nil, errors.New("down")
+	})
+	assert.Equal(t, &chat.ReplyError{Method: "ping", Message: "down"}, conn.Ping(ctx))
+	assert.Equal(t, &chat.ReplyError{Method: "nope", Message: ErrUnknownMethod}, conn.Call(ctx, "nope", nil, nil))
+}
+
+func TestServerPermissions(t *testing.T) {
+	srv := NewServer(5)
+	defer srv.Close()
+	srv.AddUser(2, "connor", "key")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn, _ := connect(t, srv)
+	defer conn.Close()
+
+	auth, err := conn.Auth(ctx, 5, 2, "wrong")
+	if assert.NoError(t, err) {
+		assert.False(t, auth.Authenticated)
+	}
+	_, err = conn.Msg(ctx, "hi")
+	assert.Equal(t, &chat.ReplyError{Method: "msg", Message: ErrNotAuthenticated}, err)
+
+	auth, err = conn.Auth(ctx, 5, 2, "key")
+	if assert.NoError(t, err) {
+		assert.True(t, auth.Authenticated)
+		assert.Equal(t, []string{"User"}, auth.Roles)
+	}
+	assert.Equal(t, &chat.ReplyError{Method: "purge", Message: ErrPermission}, conn.Purge(ctx, "bot"))
+	assert.NoError(t, conn.Ping(ctx))
+}
+
+func TestServerPoll(t *testing.T) {
+	srv := NewServer(5)
+	defer srv.Close()
+	srv.AddUser(1, "bot", "key", "Owner")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn, events := connect(t, srv)
+	defer conn.Close()
+	_, err := conn.Auth(ctx, 5, 1, "key")
+	assert.NoError(t, err)
+
+	assert.NoError(t, conn.VoteStart(ctx, "best?", 60, "go", "rust"))
+	if evt, ok := next(t, events).(*chat.PollStart); assert.True(t, ok) {
+		assert.Equal(t, "best?", evt.Question)
+		assert.Equal(t, int64(60000), evt.Duration)
+	}
+	assert.Equal(t, &chat.ReplyError{Method: "vote:start", Message: ErrPollRunning}, conn.VoteStart(ctx, "again?", 60, "a", "b"))
+
+	assert.NoError(t, conn.VoteChoose(ctx, 0))
+	if evt, ok := next(t, events).(*chat.PollStart); assert.True(t, ok) {
+		assert.Equal(t, 1, evt.Voters)
+		assert.Equal(t, 1, evt.Responses["go"])
+	}
+	assert.Equal(t, &chat.ReplyError{Method: "vote:choose", Message: ErrAlreadyVoted}, conn.VoteChoose(ctx, 1))
+
+	// The running poll is a copy.
+	if poll, ok := srv.Poll(); assert.True(t, ok) {
+		poll.Responses["go"] = 10
+		poll.Answers[0] = "c"
+	}
+	if poll, ok := srv.Poll(); assert.True(t, ok) {
+		assert.Equal(t, []string{"go", "rust"}, poll.Answers)
+		assert.Equal(t, 1, poll.Votes("go"))
+	}
+
+	srv.EndPoll()
+	if evt, ok := next(t, events).(*chat.PollEnd); assert.True(t, ok) {
+		assert.Equal(t, map[string]int{"go": 1, "rust": 0}, evt.Responses)
+	}
+	_, running := srv.Poll()
+	assert.False(t, running)
+	assert.Equal(t, &chat.ReplyError{Method: "vote:choose", Message: ErrNoPoll}, conn.VoteChoose(ctx, 0))
+}
@@ -0,0 +1,334 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	ws "github.com/gorilla/websocket"
+	beam "gitlab.com/toby3d/mixer"
+)
+
+// Connection states reported by a Client.
+const (
+	StateConnecting State = iota
+	StateConnected
+	StateDisconnected
+	StateClosed
+)
+
+const (
+	defaultMinBackoff  = 500 * time.Millisecond
+	defaultMaxBackoff  = 30 * time.Second
+	defaultAuthTimeout = 10 * time.Second
+)
+
+// ErrNotAuthenticated is returned when the server refuses the auth key.
+var ErrNotAuthenticated = errors.New("chat: not authenticated")
+
+type (
+	// State is the state of a supervised connection.
+	State int
+
+	// StateChange is passed to func(*StateChange) handlers every time the
+	// state of a Client changes. Such handlers are called from the goroutine
+	// running the Client, not from the event loop of a connection.
+	StateChange struct {
+		State State
+
+		// The endpoint in use.
+		Endpoint string
+
+		// The number of failed attempts in a row.
+		Attempt int
+
+		// The roles granted by the server, set when connected.
+		Roles []string
+
+		// The reason of the disconnect, or of the failed attempt.
+		Err error
+	}
+
+	// Client keeps a chat connection alive. It dials the endpoints in turn,
+	// authenticates with the same arguments every time and waits with a
+	// jittered exponential backoff between the failed attempts. Handlers
+	// registered on the Client or on any of its connections outlive the
+	// reconnects. A Client literal works like one made by NewClient.
+	Client struct {
+		// The chat servers to dial, in order. The chat server of the
+		// environment is dialed if there are none.
+		Endpoints []string
+
+		// The environment to use, beam.DefaultEnvironment if nil.
+		Environment *beam.Environment
+
+		// The arguments of Auth.
+		ChannelID int
+		UserID    int
+		Key       string
+
+		// The dialer to use, ws.DefaultDialer if nil.
+		Dialer *ws.Dialer
+
+		// The bounds of the reconnect backoff, defaultMinBackoff and
+		// defaultMaxBackoff if zero.
+		MinBackoff time.Duration
+		MaxBackoff time.Duration
+
+		// The keepalive of the connections, a connection which misses its
+		// beats is closed and dialed again. DefaultHeartbeat if zero, set a
+		// negative Interval to disable it.
+		Heartbeat Heartbeat
+
+		handlers *registry
+
+		mu        sync.Mutex
+		conn      *Connection
+		connected chan struct{}
+	}
+)
+
+// NewClient returns a Client which authenticates in the channel as the user
+// with the key, leave userID and key empty to join anonymously.
+func NewClient(channelID, userID int, key string, endpoints ...string) *Client {
+	return &Client{
+		Endpoints:  endpoints,
+		ChannelID:  channelID,
+		UserID:     userID,
+		Key:        key,
+		MinBackoff: defaultMinBackoff,
+		MaxBackoff: defaultMaxBackoff,
+		Heartbeat:  DefaultHeartbeat,
+		handlers:   newRegistry(),
+		connected:  make(chan struct{}),
+	}
+}
+
+// Handle registers a handler on every connection made by the client, see
+// Connection.Handle.
+func (cl *Client) Handle(fn interface{}) (remove func()) {
+	return cl.events().add(fn)
+}
+
+// Notify relays every incoming event to ch, see Connection.Notify.
+func (cl *Client) Notify(ch chan<- interface{}) (stop func()) {
+	return cl.Handle(notifier(ch))
+}
+
+// Tap registers fn on every connection made by the client, see
+// Connection.Tap.
+func (cl *Client) Tap(fn func(dir Direction, frame []byte)) (remove func()) {
+	return cl.events().addTap(fn)
+}
+
+// Conn returns the current connection, or nil while reconnecting.
+func (cl *Client) Conn() *Connection {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	return cl.conn
+}
+
+// Wait returns the current connection, waiting for the client to connect if
+// needed.
+func (cl *Client) Wait(ctx context.Context) (*Connection, error) {
+	for {
+		cl.mu.Lock()
+		if cl.connected == nil {
+			cl.connected = make(chan struct{})
+		}
+		conn, connected := cl.conn, cl.connected
+		cl.mu.Unlock()
+		if conn != nil {
+			return conn, nil
+		}
+
+		select {
+		case <-connected:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Call waits for the connection and calls the method on it, see
+// Connection.Call.
+func (cl *Client) Call(ctx context.Context, method string, args []interface{}, result interface{}) error {
+	conn, err := cl.Wait(ctx)
+	if err != nil {
+		return err
+	}
+
+	return conn.Call(ctx, method, args, result)
+}
+
+// History waits for the connection and returns the last messages of the
+// chat, see Connection.History.
+func (cl *Client) History(ctx context.Context, limit int) ([]*ChatMessage, error) {
+	conn, err := cl.Wait(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return conn.History(ctx, limit)
+}
+
+// Run connects and reconnects until ctx is done, then closes the connection.
+func (cl *Client) Run(ctx context.Context) error {
+	endpoints := cl.Endpoints
+	if len(endpoints) == 0 {
+		env := cl.Environment
+		if env == nil {
+			env = beam.DefaultEnvironment
+		}
+		if env.ChatURL == "" {
+			return errors.New("chat: no endpoints")
+		}
+		endpoints = []string{env.ChatURL}
+	}
+
+	for attempt, next := 0, 0; ; next++ {
+		endpoint := endpoints[next%len(endpoints)]
+		cl.emit(&StateChange{State: StateConnecting, Endpoint: endpoint, Attempt: attempt})
+
+		conn, roles, err := cl.connect(ctx, endpoint)
+		if err == nil {
+			attempt = 0
+			stop := conn.StartHeartbeat(cl.heartbeat())
+			cl.setConn(conn)
+			cl.emit(&StateChange{State: StateConnected, Endpoint: endpoint, Roles: roles})
+
+			select {
+			case <-conn.Done():
+				stop()
+				err = conn.Err()
+				cl.setConn(nil)
+			case <-ctx.Done():
+				stop()
+				conn.Close()
+				<-conn.Done()
+				cl.setConn(nil)
+				cl.emit(&StateChange{State: StateClosed, Endpoint: endpoint, Err: ctx.Err()})
+				return ctx.Err()
+			}
+		}
+
+		attempt++
+		cl.emit(&StateChange{State: StateDisconnected, Endpoint: endpoint, Attempt: attempt, Err: err})
+
+		select {
+		case <-time.After(cl.backoff(attempt)):
+		case <-ctx.Done():
+			cl.emit(&StateChange{State: StateClosed, Endpoint: endpoint, Err: ctx.Err()})
+			return ctx.Err()
+		}
+	}
+}
+
+// connect dials the endpoint and authenticates.
+func (cl *Client) connect(ctx context.Context, endpoint string) (*Connection, []string, error) {
+	dialer := cl.Dialer
+	if dialer == nil {
+		dialer = ws.DefaultDialer
+	}
+
+	dial, _, err := dialer.DialContext(ctx, endpoint, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	conn := newConnection(dial, cl.events())
+	conn.start()
+
+	authCtx, cancel := context.WithTimeout(ctx, defaultAuthTimeout)
+	defer cancel()
+
+	rpl, err := conn.Auth(authCtx, cl.ChannelID, cl.UserID, cl.Key)
+	if err == nil && cl.Key != "" && !rpl.Authenticated {
+		err = ErrNotAuthenticated
+	}
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+
+	return conn, rpl.Roles, nil
+}
+
+func (cl *Client) setConn(conn *Connection) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	cl.conn = conn
+	if cl.connected == nil {
+		cl.connected = make(chan struct{})
+	}
+	if conn != nil {
+		close(cl.connected)
+	} else {
+		cl.connected = make(chan struct{})
+	}
+}
+
+func (cl *Client) emit(change *StateChange) {
+	cl.events().call(eventState, change)
+}
+
+// events returns the handlers of the client, made on first use so that a
+// Client literal works.
+func (cl *Client) events() *registry {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	if cl.handlers == nil {
+		cl.handlers = newRegistry()
+	}
+	return cl.handlers
+}
+
+// heartbeat returns the keepalive of the connections.
+func (cl *Client) heartbeat() Heartbeat {
+	if cl.Heartbeat == (Heartbeat{}) {
+		return DefaultHeartbeat
+	}
+	return cl.Heartbeat
+}
+
+// backoff returns a random delay in the upper half of MinBackoff doubled on
+// every failed attempt, up to MaxBackoff.
+func (cl *Client) backoff(attempt int) time.Duration {
+	min, max := cl.MinBackoff, cl.MaxBackoff
+	if min <= 0 {
+		min = defaultMinBackoff
+	}
+	if max <= 0 {
+		max = defaultMaxBackoff
+	}
+
+	d := min
+	for i := 1; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// String returns the name of the state.
+func (s State) String() string {
+	switch s {
+	case StateConnecting:
+		return "connecting"
+	case StateConnected:
+		return "connected"
+	case StateDisconnected:
+		return "disconnected"
+	case StateClosed:
+		return "closed"
+	}
+
+	return "unknown"
+}
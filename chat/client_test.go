@@ -0,0 +1,159 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	ws "github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	beam "gitlab.com/toby3d/mixer"
+)
+
+// authServer replies to auth and then either drops the socket or keeps it.
+func authServer(auths chan<- []interface{}, drop bool) func(*ws.Conn) {
+	return func(conn *ws.Conn) {
+		var mtd Method
+		if err := conn.ReadJSON(&mtd); err != nil {
+			return
+		}
+		auths <- mtd.Arguments
+		conn.WriteJSON(&Reply{
+			Type: typeReply,
+			ID:   mtd.ID,
+			Data: json.RawMessage(`{"authenticated":true,"roles":["Owner"]}`),
+		})
+		if drop {
+			return
+		}
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func TestClientReconnects(t *testing.T) {
+	auths := make(chan []interface{}, 4)
+	dropping := serve(authServer(auths, true))
+	defer dropping.Close()
+	stable := serve(authServer(auths, false))
+	defer stable.Close()
+
+	cl := NewClient(1, 2, "key",
+		"ws"+strings.TrimPrefix(dropping.URL, "http"),
+		"ws"+strings.TrimPrefix(stable.URL, "http"),
+	)
+	cl.MinBackoff = time.Millisecond
+	cl.MaxBackoff = 10 * time.Millisecond
+
+	states := make(chan *StateChange, 16)
+	cl.Handle(func(change *StateChange) { states <- change })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- cl.Run(ctx) }()
+
+	waitCtx, waitCancel := context.WithTimeout(ctx, 5*time.Second)
+	defer waitCancel()
+
+	// The first connection is dropped right after auth, the second one stays.
+	var connected int
+	for connected < 2 {
+		select {
+		case change := <-states:
+			if change.State == StateConnected {
+				connected++
+				assert.Equal(t, []string{"Owner"}, change.Roles)
+			}
+		case <-waitCtx.Done():
+			t.Fatal("client did not reconnect")
+		}
+	}
+
+	conn, err := cl.Wait(waitCtx)
+	assert.NoError(t, err)
+	assert.NotNil(t, conn)
+
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, []interface{}{1.0, 2.0, "key"}, <-auths)
+	}
+
+	cancel()
+	assert.Equal(t, context.Canceled, <-done)
+	for change := range states {
+		if change.State == StateClosed {
+			break
+		}
+	}
+}
+
+func TestClientEnvironment(t *testing.T) {
+	auths := make(chan []interface{}, 1)
+	srv := serve(authServer(auths, false))
+	defer srv.Close()
+
+	env, err := beam.HostEnvironment(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cl := NewClient(1, 0, "")
+	cl.Environment = env
+
+	states := make(chan *StateChange, 16)
+	cl.Handle(func(change *StateChange) { states <- change })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- cl.Run(ctx) }()
+
+	_, err = cl.Wait(ctx)
+	assert.NoError(t, err)
+	for change := range states {
+		if change.State == StateConnected {
+			assert.Equal(t, env.ChatURL, change.Endpoint)
+			break
+		}
+	}
+
+	cancel()
+	<-done
+}
+
+func TestClientLiteral(t *testing.T) {
+	auths := make(chan []interface{}, 1)
+	srv := serve(authServer(auths, false))
+	defer srv.Close()
+
+	cl := &Client{Endpoints: []string{"ws" + strings.TrimPrefix(srv.URL, "http")}, ChannelID: 1}
+	states := make(chan *StateChange, 16)
+	cl.Handle(func(change *StateChange) { states <- change })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- cl.Run(ctx) }()
+
+	_, err := cl.Wait(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{1.0}, <-auths)
+
+	cancel()
+	assert.Equal(t, context.Canceled, <-done)
+
+	// The zero backoff falls back to the defaults instead of spinning.
+	for attempt := 1; attempt < 10; attempt++ {
+		d := cl.backoff(attempt)
+		assert.True(t, d >= defaultMinBackoff/2 && d <= defaultMaxBackoff, "%s", d)
+	}
+
+	// The zero heartbeat falls back to the default, a negative interval
+	// disables it.
+	assert.Equal(t, DefaultHeartbeat, cl.heartbeat())
+	cl.Heartbeat = Heartbeat{Interval: -1}
+	assert.Equal(t, Heartbeat{Interval: -1}, cl.heartbeat())
+}
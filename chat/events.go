@@ -0,0 +1,209 @@
+package chat
+
+import ffjson "github.com/pquerna/ffjson/ffjson"
+
+// Names of the events sent by the chat server.
+const (
+	EventChatMessage      = "ChatMessage"
+	EventUserJoin         = "UserJoin"
+	EventUserLeave        = "UserLeave"
+	EventPollStart        = "PollStart"
+	EventPollEnd          = "PollEnd"
+	EventDeleteMessage    = "DeleteMessage"
+	EventPurgeMessage     = "PurgeMessage"
+	EventClearMessages    = "ClearMessages"
+	EventUserUpdate       = "UserUpdate"
+	EventUserTimeout      = "UserTimeout"
+	EventSkillAttribution = "SkillAttribution"
+	EventWelcome          = "WelcomeEvent"
+)
+
+type (
+	// User describes the author or target of an event.
+	User struct {
+		UserName  string   `json:"user_name"`
+		UserID    uint     `json:"user_id"`
+		UserRoles []string `json:"user_roles"`
+		UserLevel uint     `json:"user_level"`
+	}
+
+	// ChatMessage is sent when a user sends a message or a whisper.
+	ChatMessage struct {
+		// The channel the message was sent in.
+		Channel uint `json:"channel"`
+
+		// The unique ID of the message.
+		ID string `json:"id"`
+
+		User
+
+		// The URL of the author avatar.
+		UserAvatar string `json:"user_avatar"`
+
+		// The message contents.
+		Message Message `json:"message"`
+
+		// The recipient of a whisper, empty for public messages.
+		Target string `json:"target"`
+	}
+
+	// UserJoin is sent when a user joins the chat.
+	UserJoin struct {
+		OriginatingChannel uint     `json:"originatingChannel"`
+		ID                 uint     `json:"id"`
+		UserName           string   `json:"username"`
+		Roles              []string `json:"roles"`
+	}
+
+	// UserLeave is sent when a user leaves the chat.
+	UserLeave struct {
+		OriginatingChannel uint   `json:"originatingChannel"`
+		ID                 uint   `json:"id"`
+		UserName           string `json:"username"`
+	}
+
+	// Poll is sent on start and end of a poll, and every time somebody votes.
+	Poll struct {
+		OriginatingChannel uint `json:"originatingChannel"`
+
+		// The question asked.
+		Question string `json:"q"`
+
+		// The possible answers.
+		Answers []string `json:"answers"`
+
+		// The user who started the poll.
+		Author User `json:"author"`
+
+		// The poll duration in milliseconds.
+		Duration int64 `json:"duration"`
+
+		// The poll end time as Unix milliseconds.
+		EndsAt int64 `json:"endsAt"`
+
+		// The number of users who voted.
+		Voters int `json:"voters"`
+
+		// The number of votes per answer.
+		Responses map[string]int `json:"responses"`
+	}
+
+	// PollStart is sent when a poll starts and every time somebody votes.
+	PollStart struct {
+		Poll
+	}
+
+	// PollEnd is sent when a poll ends.
+	PollEnd struct {
+		Poll
+	}
+
+	// DeleteMessage is sent when a message is deleted.
+	DeleteMessage struct {
+		// The ID of the deleted message.
+		ID string `json:"id"`
+
+		// The user who deleted the message.
+		Moderator User `json:"moderator"`
+	}
+
+	// PurgeMessage is sent when the messages of a user are purged.
+	PurgeMessage struct {
+		// The ID of the user whose messages were purged.
+		UserID uint `json:"user_id"`
+
+		// The user who purged the messages.
+		Moderator User `json:"moderator"`
+	}
+
+	// ClearMessages is sent when the chat is cleared.
+	ClearMessages struct {
+		// The user who cleared the chat.
+		Clearer User `json:"clearer"`
+	}
+
+	// UserUpdate is sent when the roles or other details of a user change.
+	UserUpdate struct {
+		UserID      uint     `json:"user"`
+		UserName    string   `json:"username"`
+		Roles       []string `json:"roles"`
+		Permissions []string `json:"permissions"`
+	}
+
+	// UserTimeout is sent when a user is timed out.
+	UserTimeout struct {
+		User User `json:"user"`
+
+		// The timeout duration in milliseconds.
+		Duration int64 `json:"duration"`
+	}
+
+	// SkillAttribution is sent when a user uses a skill with the message.
+	SkillAttribution struct {
+		// The unique ID of the message.
+		ID string `json:"id"`
+
+		User
+
+		// The URL of the author avatar.
+		UserAvatar string `json:"user_avatar"`
+
+		// The message contents.
+		Message Message `json:"message"`
+
+		Skill struct {
+			SkillID     string `json:"skill_id"`
+			SkillName   string `json:"skill_name"`
+			ExecutionID string `json:"execution_id"`
+			IconURL     string `json:"icon_url"`
+			Cost        int    `json:"cost"`
+			Currency    string `json:"currency"`
+		} `json:"skill"`
+	}
+
+	// Welcome is the first event sent after connecting.
+	Welcome struct {
+		// The ID of the server which handles the connection.
+		Server string `json:"server"`
+	}
+)
+
+// DecodeEvent returns the typed data of a known event, like *ChatMessage or
+// *UserJoin. Unknown events are returned as is.
+func DecodeEvent(evt *Event) (interface{}, error) {
+	var data interface{}
+	switch evt.Event {
+	case EventChatMessage:
+		data = new(ChatMessage)
+	case EventUserJoin:
+		data = new(UserJoin)
+	case EventUserLeave:
+		data = new(UserLeave)
+	case EventPollStart:
+		data = new(PollStart)
+	case EventPollEnd:
+		data = new(PollEnd)
+	case EventDeleteMessage:
+		data = new(DeleteMessage)
+	case EventPurgeMessage:
+		data = new(PurgeMessage)
+	case EventClearMessages:
+		data = new(ClearMessages)
+	case EventUserUpdate:
+		data = new(UserUpdate)
+	case EventUserTimeout:
+		data = new(UserTimeout)
+	case EventSkillAttribution:
+		data = new(SkillAttribution)
+	case EventWelcome:
+		data = new(Welcome)
+	default:
+		return evt, nil
+	}
+
+	if len(evt.Data) == 0 {
+		return data, nil
+	}
+
+	return data, ffjson.Unmarshal(evt.Data, data)
+}
@@ -0,0 +1,73 @@
+package chat
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	ws "github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleEvents(t *testing.T) {
+	srv := serve(func(conn *ws.Conn) {
+		// Events are sent once the client has registered its handlers and
+		// pinged the server.
+		var ping Method
+		if err := conn.ReadJSON(&ping); err != nil {
+			return
+		}
+		conn.WriteJSON(&Reply{Type: typeReply, ID: ping.ID})
+
+		conn.WriteMessage(ws.TextMessage, []byte(`{"type":"event","event":"WelcomeEvent","data":{"server":"0b7c4fe6"}}`))
+		conn.WriteMessage(ws.TextMessage, []byte(`{"type":"event","event":"UserJoin","data":{"originatingChannel":1,"username":"connor","roles":["User"],"id":146}}`))
+		conn.WriteMessage(ws.TextMessage, []byte(`{"type":"event","event":"ChatMessage","data":{"channel":1,"id":"6351f9e0","user_name":"connor","user_id":146,"user_roles":["User"],"message":{"message":[{"type":"text","data":"!ping","text":"!ping"}],"meta":{}}}}`))
+
+		// Reply to the message sent from the ChatMessage handler.
+		var mtd Method
+		if err := conn.ReadJSON(&mtd); err != nil {
+			return
+		}
+		conn.WriteJSON(&Reply{Type: typeReply, ID: mtd.ID})
+		conn.ReadMessage()
+	})
+	defer srv.Close()
+
+	conn := dial(t, srv)
+	defer conn.Close()
+
+	all := make(chan interface{}, 3)
+	conn.Notify(all)
+
+	joined := make(chan *UserJoin, 1)
+	conn.Handle(func(evt *UserJoin) { joined <- evt })
+
+	replied := make(chan error, 1)
+	conn.Handle(func(evt *ChatMessage) {
+		assert.Equal(t, "connor", evt.UserName)
+		assert.Equal(t, uint(146), evt.UserID)
+		_, err := conn.Msg(context.Background(), "pong")
+		replied <- err
+	})
+
+	assert.NoError(t, conn.Ping(context.Background()))
+
+	select {
+	case evt := <-joined:
+		assert.Equal(t, "connor", evt.UserName)
+		assert.Equal(t, []string{"User"}, evt.Roles)
+	case <-time.After(5 * time.Second):
+		t.Fatal("UserJoin was not handled")
+	}
+
+	select {
+	case err := <-replied:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("ChatMessage was not handled")
+	}
+
+	assert.IsType(t, &Welcome{}, <-all)
+	assert.IsType(t, &UserJoin{}, <-all)
+	assert.IsType(t, &ChatMessage{}, <-all)
+}
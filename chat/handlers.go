@@ -0,0 +1,232 @@
+package chat
+
+import (
+	"fmt"
+	"sync"
+)
+
+// eventState is the registry name of StateChange handlers.
+const eventState = "state"
+
+type (
+	handler struct {
+		fn func(interface{})
+	}
+
+	tap struct {
+		fn func(Direction, []byte)
+	}
+
+	// registry holds event handlers by event name, catch-all handlers are
+	// stored under the empty name, and the taps of the raw frames.
+	registry struct {
+		mu       sync.Mutex
+		handlers map[string][]*handler
+		taps     []*tap
+	}
+
+	// queued is an event waiting to be handled.
+	queued struct {
+		name string
+		data interface{}
+	}
+)
+
+// Handle registers a handler for incoming events and returns a function which
+// removes it. The handler must be one of func(*ChatMessage), func(*UserJoin),
+// func(*UserLeave), func(*PollStart), func(*PollEnd), func(*DeleteMessage),
+// func(*PurgeMessage), func(*ClearMessages), func(*UserUpdate),
+// func(*UserTimeout), func(*SkillAttribution), func(*Welcome),
+// func(*StateChange) or func(interface{}) to receive every event.
+//
+// Handlers are called one by one in a separate goroutine in the order the
+// events arrived, so they may use the connection to call methods.
+func (c *Connection) Handle(fn interface{}) (remove func()) {
+	return c.handlers.add(fn)
+}
+
+// Notify relays every incoming event to ch and returns a function which stops
+// relaying. Like signal.Notify, the connection does not block sending to ch:
+// the caller must ensure that ch has sufficient buffer space.
+func (c *Connection) Notify(ch chan<- interface{}) (stop func()) {
+	return c.Handle(notifier(ch))
+}
+
+// Tap registers fn to be called with every frame sent or received by the
+// connection, as it is on the socket, and returns a function which removes it.
+// Taps are called from the reading goroutine and while writing, so they must
+// be fast, and must not modify the frame.
+func (c *Connection) Tap(fn func(dir Direction, frame []byte)) (remove func()) {
+	return c.handlers.addTap(fn)
+}
+
+func newRegistry() *registry {
+	return &registry{handlers: make(map[string][]*handler)}
+}
+
+func (r *registry) add(fn interface{}) (remove func()) {
+	name, h := newHandler(fn)
+
+	r.mu.Lock()
+	r.handlers[name] = append(r.handlers[name], h)
+	r.mu.Unlock()
+
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		list := r.handlers[name]
+		for i := range list {
+			if list[i] == h {
+				r.handlers[name] = append(list[:i:i], list[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+func (r *registry) addTap(fn func(Direction, []byte)) (remove func()) {
+	t := &tap{fn: fn}
+
+	r.mu.Lock()
+	r.taps = append(r.taps, t)
+	r.mu.Unlock()
+
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		for i := range r.taps {
+			if r.taps[i] == t {
+				r.taps = append(r.taps[:i:i], r.taps[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// tap passes a frame to the taps.
+func (r *registry) tap(dir Direction, frame []byte) {
+	r.mu.Lock()
+	taps := r.taps
+	r.mu.Unlock()
+
+	for _, t := range taps {
+		t.fn(dir, frame)
+	}
+}
+
+// call passes data to the handlers of the named event and, unless the event
+// is internal, to the catch-all handlers.
+func (r *registry) call(name string, data interface{}) {
+	r.mu.Lock()
+	var list []*handler
+	if _, raw := data.(*Event); !raw {
+		list = append(list, r.handlers[name]...)
+	}
+	if name != eventState {
+		list = append(list, r.handlers[""]...)
+	}
+	r.mu.Unlock()
+
+	for _, h := range list {
+		h.fn(data)
+	}
+}
+
+func notifier(ch chan<- interface{}) func(interface{}) {
+	return func(evt interface{}) {
+		select {
+		case ch <- evt:
+		default:
+		}
+	}
+}
+
+func newHandler(fn interface{}) (string, *handler) {
+	switch fn := fn.(type) {
+	case func(interface{}):
+		return "", &handler{fn: fn}
+	case func(*ChatMessage):
+		return EventChatMessage, &handler{fn: func(v interface{}) { fn(v.(*ChatMessage)) }}
+	case func(*UserJoin):
+		return EventUserJoin, &handler{fn: func(v interface{}) { fn(v.(*UserJoin)) }}
+	case func(*UserLeave):
+		return EventUserLeave, &handler{fn: func(v interface{}) { fn(v.(*UserLeave)) }}
+	case func(*PollStart):
+		return EventPollStart, &handler{fn: func(v interface{}) { fn(v.(*PollStart)) }}
+	case func(*PollEnd):
+		return EventPollEnd, &handler{fn: func(v interface{}) { fn(v.(*PollEnd)) }}
+	case func(*DeleteMessage):
+		return EventDeleteMessage, &handler{fn: func(v interface{}) { fn(v.(*DeleteMessage)) }}
+	case func(*PurgeMessage):
+		return EventPurgeMessage, &handler{fn: func(v interface{}) { fn(v.(*PurgeMessage)) }}
+	case func(*ClearMessages):
+		return EventClearMessages, &handler{fn: func(v interface{}) { fn(v.(*ClearMessages)) }}
+	case func(*UserUpdate):
+		return EventUserUpdate, &handler{fn: func(v interface{}) { fn(v.(*UserUpdate)) }}
+	case func(*UserTimeout):
+		return EventUserTimeout, &handler{fn: func(v interface{}) { fn(v.(*UserTimeout)) }}
+	case func(*SkillAttribution):
+		return EventSkillAttribution, &handler{fn: func(v interface{}) { fn(v.(*SkillAttribution)) }}
+	case func(*Welcome):
+		return EventWelcome, &handler{fn: func(v interface{}) { fn(v.(*Welcome)) }}
+	case func(*StateChange):
+		return eventState, &handler{fn: func(v interface{}) { fn(v.(*StateChange)) }}
+	}
+
+	panic(fmt.Sprintf("chat: unsupported handler type %T", fn))
+}
+
+// enqueue adds a decoded event to the queue of the event loop.
+func (c *Connection) enqueue(evt *Event) {
+	data, err := DecodeEvent(evt)
+	if err != nil {
+		data = evt
+	}
+	if msg, ok := data.(*ChatMessage); ok {
+		c.mu.Lock()
+		for _, live := range c.live {
+			live.ids[msg.ID] = struct{}{}
+		}
+		c.mu.Unlock()
+	}
+
+	c.queueMu.Lock()
+	c.queue = append(c.queue, queued{name: evt.Event, data: data})
+	c.queueMu.Unlock()
+
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+// eventLoop calls the handlers of queued events until the socket is closed and
+// the queue is drained.
+func (c *Connection) eventLoop() {
+	for {
+		c.queueMu.Lock()
+		batch := c.queue
+		c.queue = nil
+		c.queueMu.Unlock()
+
+		for _, evt := range batch {
+			c.handlers.call(evt.name, evt.data)
+		}
+		if len(batch) > 0 {
+			continue
+		}
+
+		select {
+		case <-c.wake:
+		case <-c.done:
+			c.queueMu.Lock()
+			empty := len(c.queue) == 0
+			c.queueMu.Unlock()
+			if empty {
+				return
+			}
+		}
+	}
+}
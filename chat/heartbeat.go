@@ -0,0 +1,209 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	ws "github.com/gorilla/websocket"
+)
+
+// latencyWindow is the number of round trips kept for the latency statistics.
+const latencyWindow = 16
+
+// DefaultHeartbeat is the heartbeat used by a Client with a zero Heartbeat.
+var DefaultHeartbeat = Heartbeat{
+	Interval:  30 * time.Second,
+	Timeout:   10 * time.Second,
+	MaxMissed: 2,
+}
+
+type (
+	// Heartbeat configures the keepalive of a connection. Every interval, a
+	// websocket ping and a ping method are sent. A beat is missed when
+	// neither the pong nor the reply arrive within the timeout, and the
+	// connection is closed with a *HeartbeatError after MaxMissed beats are
+	// missed in a row.
+	Heartbeat struct {
+		// The time between two beats, the heartbeat is disabled if zero or
+		// negative.
+		Interval time.Duration
+
+		// The time to wait for the pong or the reply, Interval if zero.
+		Timeout time.Duration
+
+		// The number of beats to miss in a row before the connection is
+		// declared dead, 1 if zero.
+		MaxMissed int
+	}
+
+	// HeartbeatError is the error of a connection which missed its beats.
+	HeartbeatError struct {
+		// The number of beats missed in a row.
+		Missed int
+
+		// The time of the last pong or reply.
+		LastSeen time.Time
+	}
+
+	// Latency is the round trip time of the ping method over the last beats.
+	Latency struct {
+		Last time.Duration
+		Min  time.Duration
+		Max  time.Duration
+		Mean time.Duration
+
+		// The number of round trips measured, at most the size of the window.
+		Samples int
+	}
+
+	// latencies is a ring of round trip times.
+	latencies struct {
+		samples [latencyWindow]time.Duration
+		next    int
+		count   int
+	}
+)
+
+// StartHeartbeat starts the keepalive of the connection until it is closed or
+// stop is called. A supervisor, like Client, sees the *HeartbeatError of a dead
+// connection through Done and Err.
+func (c *Connection) StartHeartbeat(hb Heartbeat) (stop func()) {
+	quit := make(chan struct{})
+	if hb.Interval > 0 {
+		go c.heartbeat(hb, quit)
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(quit) })
+	}
+}
+
+// Latency returns the round trip statistics of the heartbeat.
+func (c *Connection) Latency() Latency {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.latency.stats()
+}
+
+// Error implements the error interface.
+func (e *HeartbeatError) Error() string {
+	return fmt.Sprintf("chat: connection dead after %d missed heartbeats", e.Missed)
+}
+
+func (c *Connection) heartbeat(hb Heartbeat, quit chan struct{}) {
+	timeout := hb.Timeout
+	if timeout <= 0 {
+		timeout = hb.Interval
+	}
+	maxMissed := hb.MaxMissed
+	if maxMissed <= 0 {
+		maxMissed = 1
+	}
+
+	ticker := time.NewTicker(hb.Interval)
+	defer ticker.Stop()
+
+	lastSeen, missed := time.Now(), 0
+	for {
+		select {
+		case <-ticker.C:
+		case <-quit:
+			return
+		case <-c.done:
+			return
+		}
+
+		if c.beat(timeout) {
+			lastSeen, missed = time.Now(), 0
+			continue
+		}
+
+		if missed++; missed >= maxMissed {
+			c.fail(&HeartbeatError{Missed: missed, LastSeen: lastSeen})
+			return
+		}
+	}
+}
+
+// beat sends a websocket ping and a ping method and reports whether the
+// server answered any of them in time.
+func (c *Connection) beat(timeout time.Duration) bool {
+	sent := time.Now()
+	if err := c.Conn.WriteControl(ws.PingMessage, nil, sent.Add(timeout)); err != nil {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	err := c.Call(ctx, "ping", nil, nil)
+	if _, replied := err.(*ReplyError); err == nil || replied {
+		rtt := time.Since(sent)
+
+		c.mu.Lock()
+		c.latency.add(rtt)
+		c.mu.Unlock()
+		return true
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lastPong.After(sent)
+}
+
+// pong records the pongs of the server, see beat.
+func (c *Connection) pong(string) error {
+	c.mu.Lock()
+	c.lastPong = time.Now()
+	c.mu.Unlock()
+
+	return nil
+}
+
+// fail closes the socket, so the connection stops with err.
+func (c *Connection) fail(err error) {
+	c.mu.Lock()
+	if c.err == nil {
+		c.err = err
+	}
+	c.mu.Unlock()
+
+	c.Conn.Close()
+}
+
+func (l *latencies) add(rtt time.Duration) {
+	l.samples[l.next] = rtt
+	l.next = (l.next + 1) % len(l.samples)
+	if l.count < len(l.samples) {
+		l.count++
+	}
+}
+
+func (l *latencies) stats() Latency {
+	if l.count == 0 {
+		return Latency{}
+	}
+
+	s := Latency{
+		Last:    l.samples[(l.next+len(l.samples)-1)%len(l.samples)],
+		Samples: l.count,
+	}
+	var sum time.Duration
+	for i := 0; i < l.count; i++ {
+		rtt := l.samples[i]
+		if i == 0 || rtt < s.Min {
+			s.Min = rtt
+		}
+		if rtt > s.Max {
+			s.Max = rtt
+		}
+		sum += rtt
+	}
+	s.Mean = sum / time.Duration(l.count)
+
+	return s
+}
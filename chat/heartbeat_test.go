@@ -0,0 +1,85 @@
+package chat
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	ws "github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeartbeat(t *testing.T) {
+	// The server answers two pings, then stops reading like a half-open
+	// socket, so neither pongs nor replies are sent.
+	stalled := make(chan struct{})
+	srv := serve(func(conn *ws.Conn) {
+		for i := 0; i < 2; i++ {
+			var mtd Method
+			if err := conn.ReadJSON(&mtd); err != nil {
+				return
+			}
+			assert.Equal(t, "ping", mtd.Method)
+			conn.WriteJSON(&Reply{Type: typeReply, ID: mtd.ID})
+		}
+		<-stalled
+	})
+	defer srv.Close()
+	defer close(stalled)
+
+	conn := dial(t, srv)
+	defer conn.Close()
+	conn.StartHeartbeat(Heartbeat{Interval: 20 * time.Millisecond, Timeout: 50 * time.Millisecond, MaxMissed: 2})
+
+	select {
+	case <-conn.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("the connection was not declared dead")
+	}
+
+	if err, ok := conn.Err().(*HeartbeatError); assert.True(t, ok, "%v", conn.Err()) {
+		assert.Equal(t, 2, err.Missed)
+		assert.False(t, err.LastSeen.IsZero())
+	}
+
+	latency := conn.Latency()
+	assert.Equal(t, 2, latency.Samples)
+	assert.True(t, latency.Min > 0 && latency.Min <= latency.Mean && latency.Mean <= latency.Max)
+
+	_, err := conn.Msg(context.Background(), "hi")
+	assert.IsType(t, &HeartbeatError{}, err)
+}
+
+func TestHeartbeatStop(t *testing.T) {
+	srv := serve(func(conn *ws.Conn) {
+		conn.ReadMessage()
+	})
+	defer srv.Close()
+
+	conn := dial(t, srv)
+	defer conn.Close()
+	stop := conn.StartHeartbeat(Heartbeat{Interval: 20 * time.Millisecond, Timeout: 20 * time.Millisecond})
+	stop()
+	stop()
+
+	time.Sleep(100 * time.Millisecond)
+	assert.NoError(t, conn.Err())
+}
+
+func TestLatencies(t *testing.T) {
+	var l latencies
+	assert.Equal(t, Latency{}, l.stats())
+
+	for i := 1; i <= latencyWindow+2; i++ {
+		l.add(time.Duration(i) * time.Millisecond)
+	}
+
+	// The first two samples left the window.
+	assert.Equal(t, Latency{
+		Last:    (latencyWindow + 2) * time.Millisecond,
+		Min:     3 * time.Millisecond,
+		Max:     (latencyWindow + 2) * time.Millisecond,
+		Mean:    (latencyWindow + 5) * time.Millisecond / 2,
+		Samples: latencyWindow,
+	}, l.stats())
+}
@@ -0,0 +1,50 @@
+package chat
+
+import (
+	"context"
+	"errors"
+
+	beam "gitlab.com/toby3d/mixer"
+)
+
+// Join connects to the chat of the channel as the user of the REST client, or
+// anonymously for read only access if the client has no OAuth token. It
+// fetches the chat servers and the auth key of the channel, dials the servers
+// in turn until one answers and authenticates. It returns the connection and
+// the roles granted by the server. The connection has no heartbeat, start one
+// with StartHeartbeat if needed.
+func Join(ctx context.Context, client *beam.Client, channelID uint) (*Connection, []string, error) {
+	details, err := client.Chats.Get(ctx, channelID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(details.Endpoints) == 0 {
+		return nil, nil, errors.New("chat: no endpoints")
+	}
+
+	var userID uint
+	if details.AuthKey != "" {
+		user, err := client.Users.Current(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		userID = user.ID
+	}
+
+	cl := NewClient(int(channelID), int(userID), details.AuthKey, details.Endpoints...)
+	for _, endpoint := range details.Endpoints {
+		var (
+			conn  *Connection
+			roles []string
+		)
+		if conn, roles, err = cl.connect(ctx, endpoint); err == nil {
+			return conn, roles, nil
+		}
+		// Other servers would refuse the key the same way.
+		if _, refused := err.(*ReplyError); refused || err == ErrNotAuthenticated || ctx.Err() != nil {
+			break
+		}
+	}
+
+	return nil, nil, err
+}
@@ -0,0 +1,99 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	ws "github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	beam "gitlab.com/toby3d/mixer"
+)
+
+// chatsServer serves the chat details of channel 5 and its chat server. The
+// auth key is only given to requests with a token.
+func chatsServer(t *testing.T, auths chan<- []interface{}) (*httptest.Server, *beam.Environment) {
+	var env *beam.Environment
+	upgrader := ws.Upgrader{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/chats/5", func(w http.ResponseWriter, r *http.Request) {
+		// The first server is down, the client has to try the next one.
+		endpoints := fmt.Sprintf(`["ws://127.0.0.1:1/chat",%q]`, env.ChatURL)
+		if r.Header.Get("Authorization") == "" {
+			fmt.Fprintf(w, `{"endpoints":%s}`, endpoints)
+			return
+		}
+		fmt.Fprintf(w, `{"roles":["User"],"authkey":"key","endpoints":%s}`, endpoints)
+	})
+	mux.HandleFunc("/api/v1/users/current", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id":7,"username":"toby3d"}`)
+	})
+	mux.HandleFunc("/chat", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		var mtd Method
+		if err := conn.ReadJSON(&mtd); err != nil {
+			return
+		}
+		auths <- mtd.Arguments
+		authenticated, roles := len(mtd.Arguments) == 3, `[]`
+		if authenticated {
+			roles = `["User"]`
+		}
+		conn.WriteJSON(&Reply{
+			Type: typeReply,
+			ID:   mtd.ID,
+			Data: json.RawMessage(fmt.Sprintf(`{"authenticated":%t,"roles":%s}`, authenticated, roles)),
+		})
+		conn.ReadMessage()
+	})
+
+	srv := httptest.NewServer(mux)
+	env, _ = beam.HostEnvironment(srv.URL)
+	return srv, env
+}
+
+// tokenTransport authorizes requests like an OAuth client.
+type tokenTransport struct{}
+
+func (tokenTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	req := *r
+	req.Header = http.Header{"Authorization": {"Bearer token"}}
+	return http.DefaultTransport.RoundTrip(&req)
+}
+
+func TestJoin(t *testing.T) {
+	auths := make(chan []interface{}, 1)
+	srv, env := chatsServer(t, auths)
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	anonymous, _ := beam.NewEnvClient(env, nil)
+	conn, roles, err := Join(ctx, anonymous, 5)
+	if assert.NoError(t, err) {
+		assert.Empty(t, roles)
+		assert.Equal(t, []interface{}{5.0}, <-auths)
+		conn.Close()
+	}
+
+	user, _ := beam.NewEnvClient(env, &http.Client{Transport: tokenTransport{}})
+	conn, roles, err = Join(ctx, user, 5)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"User"}, roles)
+		assert.Equal(t, []interface{}{5.0, 7.0, "key"}, <-auths)
+		conn.Close()
+	}
+
+	_, _, err = Join(ctx, anonymous, 6)
+	assert.Error(t, err)
+}
@@ -0,0 +1,219 @@
+package chat
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	ffjson "github.com/pquerna/ffjson/ffjson"
+)
+
+// Types of the message segments.
+const (
+	SegmentText         = "text"
+	SegmentEmoticon     = "emoticon"
+	SegmentLink         = "link"
+	SegmentTag          = "tag"
+	SegmentInASpaceSuit = "inaspacesuit"
+)
+
+type (
+	// Message is the contents of a chat message split into segments.
+	Message struct {
+		Message []MessageSegment `json:"message"`
+		Meta    MessageMeta      `json:"meta"`
+	}
+
+	MessageMeta struct {
+		// Indicates that the message is a whisper.
+		Whisper bool `json:"whisper,omitempty"`
+
+		// Indicates that the message is an action sent with /me.
+		Me bool `json:"me,omitempty"`
+
+		// Indicates that the message was censored by the server.
+		Censored bool `json:"censored,omitempty"`
+	}
+
+	// MessageSegment is a piece of a message. Text always holds the text the
+	// segment was made from, the other fields depend on Type.
+	MessageSegment struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+
+		// The text of a text segment.
+		Data string `json:"data,omitempty"`
+
+		// The emoticon pack of an emoticon segment.
+		Source string            `json:"source,omitempty"` // (builtin, external)
+		Pack   string            `json:"pack,omitempty"`
+		Coords *EmoticonCoords   `json:"coords,omitempty"`
+		Alt    map[string]string `json:"alt,omitempty"`
+
+		// The target of a link segment.
+		URL string `json:"url,omitempty"`
+
+		// The mentioned user of a tag segment, or the user of an
+		// inaspacesuit segment.
+		UserName string `json:"username,omitempty"`
+		ID       uint   `json:"id,omitempty"`
+		UserID   uint   `json:"userId,omitempty"`
+	}
+
+	// EmoticonCoords locates an emoticon in its pack.
+	EmoticonCoords struct {
+		X      int `json:"x"`
+		Y      int `json:"y"`
+		Width  int `json:"width"`
+		Height int `json:"height"`
+	}
+
+	// MessageBuilder makes the text of an outgoing message. The server splits
+	// messages into segments by whitespace, so mentions and emoticons are
+	// always separated from the surrounding text.
+	MessageBuilder struct {
+		buf bytes.Buffer
+		me  bool
+		sep bool
+	}
+)
+
+// DecodeMessage decodes the contents of a message, either an object with the
+// segments and meta or a bare array of segments.
+func DecodeMessage(data []byte) (*Message, error) {
+	var msg Message
+	if err := ffjson.Unmarshal(data, &msg); err != nil {
+		return nil, err
+	}
+
+	return &msg, nil
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (m *Message) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		*m = Message{}
+		return json.Unmarshal(data, &m.Message)
+	}
+
+	type message Message
+	return json.Unmarshal(data, (*message)(m))
+}
+
+// PlainText returns the message as it was typed.
+func (m *Message) PlainText() string {
+	var buf bytes.Buffer
+	for i := range m.Message {
+		buf.WriteString(m.Message[i].PlainText())
+	}
+
+	return buf.String()
+}
+
+// Links returns the URLs of the link segments.
+func (m *Message) Links() []string {
+	var links []string
+	for _, seg := range m.Message {
+		if seg.Type == SegmentLink {
+			links = append(links, seg.URL)
+		}
+	}
+
+	return links
+}
+
+// Mentions returns the usernames of the tag segments.
+func (m *Message) Mentions() []string {
+	var names []string
+	for _, seg := range m.Message {
+		if seg.Type == SegmentTag {
+			names = append(names, seg.UserName)
+		}
+	}
+
+	return names
+}
+
+// Emoticons returns the emoticon segments.
+func (m *Message) Emoticons() []MessageSegment {
+	var emoticons []MessageSegment
+	for _, seg := range m.Message {
+		if seg.Type == SegmentEmoticon {
+			emoticons = append(emoticons, seg)
+		}
+	}
+
+	return emoticons
+}
+
+// PlainText returns the text of the segment.
+func (seg *MessageSegment) PlainText() string {
+	if seg.Text == "" && seg.Type == SegmentText {
+		return seg.Data
+	}
+
+	return seg.Text
+}
+
+// NewMessage returns an empty MessageBuilder.
+func NewMessage() *MessageBuilder {
+	return new(MessageBuilder)
+}
+
+// Me turns the message into an action, like /me in the chat.
+func (b *MessageBuilder) Me() *MessageBuilder {
+	b.me = true
+	return b
+}
+
+// Text appends plain text.
+func (b *MessageBuilder) Text(text string) *MessageBuilder {
+	if text == "" {
+		return b
+	}
+	if r, _ := utf8.DecodeRuneInString(text); b.sep && !unicode.IsSpace(r) {
+		b.buf.WriteByte(' ')
+	}
+	b.sep = false
+	b.buf.WriteString(text)
+
+	return b
+}
+
+// Mention appends a mention of the user.
+func (b *MessageBuilder) Mention(username string) *MessageBuilder {
+	return b.word("@" + strings.TrimPrefix(username, "@"))
+}
+
+// Emoticon appends an emoticon by its text, like ":)" or ":mappa".
+func (b *MessageBuilder) Emoticon(text string) *MessageBuilder {
+	return b.word(text)
+}
+
+// Link appends a link.
+func (b *MessageBuilder) Link(url string) *MessageBuilder {
+	return b.word(url)
+}
+
+// String returns the text of the message.
+func (b *MessageBuilder) String() string {
+	if b.me {
+		return "/me " + b.buf.String()
+	}
+
+	return b.buf.String()
+}
+
+// word appends a whitespace separated word.
+func (b *MessageBuilder) word(word string) *MessageBuilder {
+	if data := b.buf.Bytes(); len(data) > 0 && !unicode.IsSpace(rune(data[len(data)-1])) {
+		b.buf.WriteByte(' ')
+	}
+	b.buf.WriteString(word)
+	b.sep = true
+
+	return b
+}
@@ -0,0 +1,47 @@
+package chat
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeMessage(t *testing.T) {
+	evt, err := DecodeEvent(&Event{
+		Type:  typeEvent,
+		Event: EventChatMessage,
+		Data: []byte(`{"channel":1,"id":"6351f9e0","user_name":"connor","user_id":1,"user_roles":["Owner"],"message":{"message":[` +
+			`{"type":"text","data":"hi ","text":"hi "},` +
+			`{"type":"tag","username":"matt","id":2,"text":"@matt"},` +
+			`{"type":"text","data":" ","text":" "},` +
+			`{"type":"emoticon","source":"builtin","pack":"default","coords":{"x":24,"y":0,"width":24,"height":24},"text":":)"},` +
+			`{"type":"text","data":" see ","text":" see "},` +
+			`{"type":"link","url":"https://mixer.com","text":"mixer.com"}` +
+			`],"meta":{"me":true}}}`),
+	})
+	assert.NoError(t, err)
+
+	msg := evt.(*ChatMessage)
+	assert.Equal(t, "hi @matt :) see mixer.com", msg.Message.PlainText())
+	assert.Equal(t, []string{"matt"}, msg.Message.Mentions())
+	assert.Equal(t, []string{"https://mixer.com"}, msg.Message.Links())
+	if emoticons := msg.Message.Emoticons(); assert.Len(t, emoticons, 1) {
+		assert.Equal(t, &EmoticonCoords{X: 24, Width: 24, Height: 24}, emoticons[0].Coords)
+	}
+	assert.True(t, msg.Message.Meta.Me)
+
+	bare, err := DecodeMessage([]byte(`[{"type":"text","data":"Hello world ","text":"Hello world!"}]`))
+	assert.NoError(t, err)
+	assert.Equal(t, "Hello world!", bare.PlainText())
+}
+
+func TestMessageBuilder(t *testing.T) {
+	msg := NewMessage().Text("hi").Mention("@matt").Text(", look").Emoticon(":)").Link("https://mixer.com")
+	assert.Equal(t, "hi @matt , look :) https://mixer.com", msg.String())
+
+	action := NewMessage().Text("waves at ").Mention("connor").Me()
+	assert.Equal(t, "/me waves at @connor", action.String())
+
+	wide := NewMessage().Mention("connor").Text("\u3000hi").Mention("matt").Text("\u00a0!")
+	assert.Equal(t, "@connor\u3000hi @matt\u00a0!", wide.String())
+}
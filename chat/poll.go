@@ -0,0 +1,345 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrPollRunning is returned when starting a poll while another one runs.
+	ErrPollRunning = errors.New("chat: a poll is already running")
+
+	// ErrNoPoll is returned when waiting for a poll while none runs.
+	ErrNoPoll = errors.New("chat: no poll is running")
+)
+
+type (
+	// Polls follows the polls of a chat. It starts polls one at a time and
+	// keeps the live counts of the running one from the poll events. A poll
+	// is over once its end passed, even if the end event is missing, and its
+	// last counts are the result until the end event arrives. It is safe for
+	// concurrent use.
+	Polls struct {
+		caller Caller
+		remove func()
+
+		mu       sync.Mutex
+		round    *pollRound
+		last     *PollResult
+		onUpdate []*pollHandler
+
+		// The end of the last poll which expired without its end event.
+		expired int64
+	}
+
+	// PollResult is a poll which ended.
+	PollResult struct {
+		Poll
+
+		// The answers with the most votes, more than one on a tie, none if
+		// nobody voted.
+		Winners []string
+	}
+
+	// pollRound is a running poll. Whoever takes it off Polls closes done.
+	pollRound struct {
+		poll   *Poll
+		done   chan struct{}
+		result *PollResult
+		err    error
+		timer  *time.Timer
+
+		// The end of a poll started here until its start event arrives.
+		deadline time.Time
+	}
+
+	pollHandler struct {
+		fn func(*Poll)
+	}
+)
+
+// NewPolls returns a poll tracker starting polls through the caller and
+// following the events of src, usually the same *Connection or *Client.
+func NewPolls(caller Caller, src EventSource) *Polls {
+	p := &Polls{caller: caller}
+	p.remove = src.Handle(p.apply)
+
+	return p
+}
+
+// Close stops following the events.
+func (p *Polls) Close() {
+	p.remove()
+}
+
+// Start starts a poll, failing with ErrPollRunning while another poll runs,
+// including the ones started by others.
+func (p *Polls) Start(ctx context.Context, question string, duration time.Duration, answers ...string) error {
+	p.mu.Lock()
+	p.expire(time.Now())
+	if p.round != nil {
+		p.mu.Unlock()
+		return ErrPollRunning
+	}
+	round := &pollRound{done: make(chan struct{}), deadline: time.Now().Add(duration)}
+	p.round = round
+	p.watch(round)
+	p.mu.Unlock()
+
+	err := p.caller.Call(ctx, "vote:start", []interface{}{question, answers, int(duration / time.Second)}, nil)
+	if err != nil {
+		p.mu.Lock()
+		if p.round == round && round.poll == nil {
+			round.err = err
+			if round.timer != nil {
+				round.timer.Stop()
+			}
+			p.round = nil
+			close(round.done)
+		}
+		p.mu.Unlock()
+	}
+
+	return err
+}
+
+// Vote chooses the answer of the running poll by its index.
+func (p *Polls) Vote(ctx context.Context, index int) error {
+	return p.caller.Call(ctx, "vote:choose", []interface{}{index}, nil)
+}
+
+// Current returns a copy of the running poll with its live counts.
+func (p *Polls) Current() (*Poll, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.expire(time.Now())
+	if p.round == nil || p.round.poll == nil {
+		return nil, false
+	}
+	return copyPoll(p.round.poll), true
+}
+
+// Last returns the result of the last poll which ended.
+func (p *Polls) Last() (*PollResult, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.expire(time.Now())
+	if p.last == nil {
+		return nil, false
+	}
+	result := *p.last
+	result.Poll = *copyPoll(&p.last.Poll)
+	result.Winners = append([]string(nil), p.last.Winners...)
+	return &result, true
+}
+
+// Wait waits for the running poll to end and returns its result. A poll
+// started here fails with the error of Start, or with ErrNoPoll if it ended
+// before its start event arrived.
+func (p *Polls) Wait(ctx context.Context) (*PollResult, error) {
+	p.mu.Lock()
+	round := p.round
+	p.expire(time.Now())
+	p.mu.Unlock()
+	if round == nil {
+		return nil, ErrNoPoll
+	}
+
+	select {
+	case <-round.done:
+		return round.result, round.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// OnUpdate registers fn to be called with a copy of the poll on start, on
+// every vote and on end.
+func (p *Polls) OnUpdate(fn func(*Poll)) (remove func()) {
+	h := &pollHandler{fn: fn}
+
+	p.mu.Lock()
+	p.onUpdate = append(p.onUpdate, h)
+	p.mu.Unlock()
+
+	return func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		for i := range p.onUpdate {
+			if p.onUpdate[i] == h {
+				p.onUpdate = append(p.onUpdate[:i:i], p.onUpdate[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// apply follows the poll events. The waiters of an ended poll are woken after
+// the update handlers saw the end.
+func (p *Polls) apply(evt interface{}) {
+	var (
+		poll  *Poll
+		ended *pollRound
+	)
+
+	p.mu.Lock()
+	switch evt := evt.(type) {
+	case *PollStart:
+		p.expire(time.Now())
+		poll = copyPoll(&evt.Poll)
+		if p.round == nil {
+			p.round = &pollRound{done: make(chan struct{})}
+		}
+		p.round.poll = poll
+		p.watch(p.round)
+	case *PollEnd:
+		poll = copyPoll(&evt.Poll)
+		p.last = &PollResult{Poll: *poll, Winners: winners(poll)}
+		// The end of an expired poll only brings its final counts.
+		if poll.EndsAt != 0 && poll.EndsAt == p.expired {
+			break
+		}
+		if ended = p.round; ended != nil {
+			ended.result = p.last
+			if ended.timer != nil {
+				ended.timer.Stop()
+			}
+		}
+		p.round = nil
+	default:
+		p.mu.Unlock()
+		return
+	}
+	handlers := p.onUpdate
+	p.mu.Unlock()
+
+	for _, h := range handlers {
+		h.fn(copyPoll(poll))
+	}
+	if ended != nil {
+		close(ended.done)
+	}
+}
+
+// watch expires the round at its end. Called with the lock held.
+func (p *Polls) watch(round *pollRound) {
+	if round.timer != nil {
+		round.timer.Stop()
+		round.timer = nil
+	}
+	end := round.end()
+	if end.IsZero() {
+		return
+	}
+
+	round.timer = time.AfterFunc(end.Sub(time.Now()), func() {
+		p.mu.Lock()
+		if p.round == round {
+			p.expire(time.Now())
+		}
+		p.mu.Unlock()
+	})
+}
+
+// expire ends the running poll with its last counts if its end passed. Called
+// with the lock held.
+func (p *Polls) expire(now time.Time) {
+	round := p.round
+	if round == nil {
+		return
+	}
+	if end := round.end(); end.IsZero() || now.Before(end) {
+		return
+	}
+
+	if round.poll != nil {
+		p.last = &PollResult{Poll: *copyPoll(round.poll), Winners: winners(round.poll)}
+		p.expired = round.poll.EndsAt
+		round.result = p.last
+	} else {
+		round.err = ErrNoPoll
+	}
+	if round.timer != nil {
+		round.timer.Stop()
+	}
+	p.round = nil
+	close(round.done)
+}
+
+// end returns when the round is over, zero if its poll has no end. A poll
+// started here without its start event is over at its deadline, so a lost
+// event does not block the next polls.
+func (round *pollRound) end() time.Time {
+	switch {
+	case round.poll == nil:
+		return round.deadline
+	case round.poll.EndsAt == 0:
+		return time.Time{}
+	}
+	return round.poll.end()
+}
+
+// Remaining returns the time left before the poll ends.
+func (poll *Poll) Remaining() time.Duration {
+	left := poll.end().Sub(time.Now())
+	if left < 0 {
+		return 0
+	}
+	return left
+}
+
+func (poll *Poll) end() time.Time {
+	return time.Unix(0, poll.EndsAt*int64(time.Millisecond))
+}
+
+// Votes returns the number of votes for the answer.
+func (poll *Poll) Votes(answer string) int {
+	return poll.Responses[answer]
+}
+
+// Winner returns the answer with the most votes, or false on a tie or if
+// nobody voted.
+func (r *PollResult) Winner() (string, bool) {
+	if len(r.Winners) != 1 {
+		return "", false
+	}
+	return r.Winners[0], true
+}
+
+// winners returns the answers with the most votes in the order of the poll.
+func winners(poll *Poll) []string {
+	var (
+		best []string
+		most int
+	)
+	for _, answer := range poll.Answers {
+		switch votes := poll.Responses[answer]; {
+		case votes == 0 || votes < most:
+		case votes > most:
+			best, most = []string{answer}, votes
+		default:
+			best = append(best, answer)
+		}
+	}
+
+	return best
+}
+
+func copyPoll(poll *Poll) *Poll {
+	c := *poll
+	c.Answers = append([]string(nil), poll.Answers...)
+	c.Author.UserRoles = append([]string(nil), poll.Author.UserRoles...)
+	if poll.Responses != nil {
+		c.Responses = make(map[string]int, len(poll.Responses))
+		for answer, votes := range poll.Responses {
+			c.Responses[answer] = votes
+		}
+	}
+
+	return &c
+}
@@ -0,0 +1,166 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// pollCaller records the calls and fails the polls asking "fail", after
+// release is closed if set.
+type pollCaller struct {
+	fakeCaller
+	release chan struct{}
+}
+
+func (c *pollCaller) Call(ctx context.Context, method string, args []interface{}, result interface{}) error {
+	err := c.fakeCaller.Call(ctx, method, args, result)
+	if method == "vote:start" && args[0] == "fail" {
+		if c.release != nil {
+			<-c.release
+		}
+		return errors.New("failed")
+	}
+	return err
+}
+
+func TestPolls(t *testing.T) {
+	caller, src := new(pollCaller), new(fakeSource)
+	p := NewPolls(caller, src)
+	defer p.Close()
+
+	var updates []map[string]int
+	p.OnUpdate(func(poll *Poll) { updates = append(updates, poll.Responses) })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := p.Wait(ctx)
+	assert.Equal(t, ErrNoPoll, err)
+
+	assert.NoError(t, p.Start(ctx, "Best?", 30*time.Second, "go", "rust", "c"))
+	assert.Equal(t, ErrPollRunning, p.Start(ctx, "Again?", time.Minute, "yes"))
+	calls := caller.recorded()
+	if assert.Len(t, calls, 1) {
+		assert.Equal(t, "vote:start", calls[0].method)
+		assert.Equal(t, []interface{}{"Best?", []string{"go", "rust", "c"}, 30}, calls[0].args)
+	}
+
+	_, ok := p.Current()
+	assert.False(t, ok)
+
+	endsAt := time.Now().Add(30*time.Second).UnixNano() / int64(time.Millisecond)
+	poll := Poll{Question: "Best?", Answers: []string{"go", "rust", "c"}, EndsAt: endsAt, Responses: map[string]int{"go": 0, "rust": 0, "c": 0}}
+	src.emit(&PollStart{poll})
+	poll.Responses = map[string]int{"go": 2, "rust": 1, "c": 0}
+	poll.Voters = 3
+	src.emit(&PollStart{poll})
+
+	current, ok := p.Current()
+	if assert.True(t, ok) {
+		assert.Equal(t, 2, current.Votes("go"))
+		assert.Equal(t, 3, current.Voters)
+		assert.InDelta(t, 30*time.Second, current.Remaining(), float64(time.Second))
+	}
+
+	poll.Responses = map[string]int{"go": 3, "rust": 1, "c": 0}
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		src.emit(&PollEnd{poll})
+	}()
+
+	result, err := p.Wait(ctx)
+	if !assert.NoError(t, err) {
+		return
+	}
+	winner, ok := result.Winner()
+	assert.True(t, ok)
+	assert.Equal(t, "go", winner)
+	assert.Len(t, updates, 3)
+
+	last, ok := p.Last()
+	assert.True(t, ok)
+	assert.Equal(t, []string{"go"}, last.Winners)
+	_, ok = p.Current()
+	assert.False(t, ok)
+
+	// A poll started by somebody else blocks Start too.
+	src.emit(&PollStart{Poll{Question: "Theirs?", Answers: []string{"a", "b"}}})
+	assert.Equal(t, ErrPollRunning, p.Start(ctx, "Mine?", time.Minute, "x"))
+	src.emit(&PollEnd{Poll{Question: "Theirs?", Answers: []string{"a", "b"}, Responses: map[string]int{"a": 1, "b": 1}}})
+	last, _ = p.Last()
+	_, ok = last.Winner()
+	assert.False(t, ok)
+	assert.Equal(t, []string{"a", "b"}, last.Winners)
+
+	// A poll is over once its end passed, and its end event only brings the
+	// final counts.
+	endsAt = time.Now().Add(20*time.Millisecond).UnixNano() / int64(time.Millisecond)
+	stale := Poll{Question: "Stale?", Answers: []string{"a", "b"}, EndsAt: endsAt, Responses: map[string]int{"a": 2, "b": 0}}
+	src.emit(&PollStart{stale})
+	result, err = p.Wait(ctx)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Stale?", result.Question)
+		assert.Equal(t, []string{"a"}, result.Winners)
+	}
+	_, ok = p.Current()
+	assert.False(t, ok)
+
+	assert.NoError(t, p.Start(ctx, "Fresh?", time.Minute, "yes"))
+	stale.Responses = map[string]int{"a": 2, "b": 3}
+	src.emit(&PollEnd{stale})
+	last, _ = p.Last()
+	assert.Equal(t, []string{"b"}, last.Winners)
+	assert.Equal(t, ErrPollRunning, p.Start(ctx, "Again?", time.Minute, "yes"))
+	src.emit(&PollEnd{Poll{Question: "Fresh?", Answers: []string{"yes"}}})
+
+	// A failed start does not block the next one.
+	assert.Error(t, p.Start(ctx, "fail", time.Minute, "yes"))
+	assert.NoError(t, p.Start(ctx, "Next?", time.Minute, "yes"))
+	src.emit(&PollEnd{Poll{Question: "Next?", Answers: []string{"yes"}}})
+	_, ok = p.Current()
+	assert.False(t, ok)
+}
+
+func TestPollsLostStart(t *testing.T) {
+	caller, src := new(pollCaller), new(fakeSource)
+	p := NewPolls(caller, src)
+	defer p.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// A poll whose start event is lost is over at its duration.
+	assert.NoError(t, p.Start(ctx, "Lost?", 20*time.Millisecond, "yes"))
+	assert.Equal(t, ErrPollRunning, p.Start(ctx, "Again?", time.Minute, "yes"))
+	_, err := p.Wait(ctx)
+	assert.Equal(t, ErrNoPoll, err)
+	_, ok := p.Last()
+	assert.False(t, ok)
+	assert.NoError(t, p.Start(ctx, "Again?", time.Minute, "yes"))
+	src.emit(&PollEnd{Poll{Question: "Again?", Answers: []string{"yes"}}})
+
+	// A failed start wakes the waiters.
+	caller.release = make(chan struct{})
+	started := make(chan error)
+	go func() { started <- p.Start(ctx, "fail", time.Minute, "yes") }()
+	for {
+		p.mu.Lock()
+		running := p.round != nil
+		p.mu.Unlock()
+		if running {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		close(caller.release)
+	}()
+	_, err = p.Wait(ctx)
+	assert.EqualError(t, err, "failed")
+	assert.EqualError(t, <-started, "failed")
+}
@@ -0,0 +1,230 @@
+package chat
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	beam "gitlab.com/toby3d/mixer"
+)
+
+const presencePageSize = 100
+
+type (
+	// EventSource is anything handlers are registered on, like *Connection
+	// or *Client.
+	EventSource interface {
+		Handle(fn interface{}) (remove func())
+	}
+
+	// Presence is the list of the users in a chat, kept up to date by the
+	// join, leave and update events. Users who join lurk until they send a
+	// message. It is safe for concurrent use.
+	Presence struct {
+		remove func()
+
+		mu      sync.Mutex
+		users   map[uint]beam.ChatUser
+		onJoin  []*presenceHandler
+		onLeave []*presenceHandler
+
+		// The events received while seeding, applied to the seeded users.
+		seeding int
+		pending []interface{}
+	}
+
+	presenceHandler struct {
+		fn func(beam.ChatUser)
+	}
+)
+
+// NewPresence returns an empty presence which follows the events of src. Use
+// Seed to fetch the users already in the chat.
+func NewPresence(src EventSource) *Presence {
+	p := &Presence{users: make(map[uint]beam.ChatUser)}
+	p.remove = src.Handle(p.apply)
+
+	return p
+}
+
+// Close stops following the events.
+func (p *Presence) Close() {
+	p.remove()
+}
+
+// Seed replaces the users by the ones in the chat of the channel, fetching
+// every page. The events received meanwhile are applied over them, as the
+// pages may miss their changes. Join and leave handlers are not called.
+func (p *Presence) Seed(ctx context.Context, client *beam.Client, channelID uint) error {
+	p.mu.Lock()
+	p.seeding++
+	start := len(p.pending)
+	p.mu.Unlock()
+
+	defer func() {
+		p.mu.Lock()
+		if p.seeding--; p.seeding == 0 {
+			p.pending = nil
+		}
+		p.mu.Unlock()
+	}()
+
+	users := make(map[uint]beam.ChatUser)
+	for page := 0; ; page++ {
+		list, err := client.Chats.Users(ctx, channelID, &beam.ListOptions{Page: page, Limit: presencePageSize})
+		if err != nil {
+			return err
+		}
+		for _, user := range list {
+			users[user.UserID] = user
+		}
+		if len(list) < presencePageSize {
+			break
+		}
+	}
+
+	p.mu.Lock()
+	for _, evt := range p.pending[start:] {
+		change(users, evt)
+	}
+	p.users = users
+	p.mu.Unlock()
+
+	return nil
+}
+
+// OnJoin registers fn to be called with every user who joins.
+func (p *Presence) OnJoin(fn func(beam.ChatUser)) (remove func()) {
+	return p.register(&p.onJoin, fn)
+}
+
+// OnLeave registers fn to be called with every user who leaves.
+func (p *Presence) OnLeave(fn func(beam.ChatUser)) (remove func()) {
+	return p.register(&p.onLeave, fn)
+}
+
+// User returns the user if in the chat.
+func (p *Presence) User(userID uint) (beam.ChatUser, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	user, ok := p.users[userID]
+	return copyChatUser(user), ok
+}
+
+// Users returns the users in the chat ordered by name.
+func (p *Presence) Users() []beam.ChatUser {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	users := make([]beam.ChatUser, 0, len(p.users))
+	for _, user := range p.users {
+		users = append(users, copyChatUser(user))
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].UserName < users[j].UserName })
+
+	return users
+}
+
+// Count returns the number of users in the chat.
+func (p *Presence) Count() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.users)
+}
+
+// Lurkers returns the number of users in the chat who did not send a message
+// since they joined or were seeded as lurking.
+func (p *Presence) Lurkers() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var n int
+	for _, user := range p.users {
+		if user.Lurking {
+			n++
+		}
+	}
+	return n
+}
+
+func (p *Presence) register(list *[]*presenceHandler, fn func(beam.ChatUser)) func() {
+	h := &presenceHandler{fn: fn}
+
+	p.mu.Lock()
+	*list = append(*list, h)
+	p.mu.Unlock()
+
+	return func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		for i := range *list {
+			if (*list)[i] == h {
+				*list = append((*list)[:i:i], (*list)[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// apply changes the users by an event and calls the handlers of joins and
+// leaves.
+func (p *Presence) apply(evt interface{}) {
+	p.mu.Lock()
+	if p.seeding > 0 {
+		p.pending = append(p.pending, evt)
+	}
+	joined, left, user := change(p.users, evt)
+
+	var handlers []*presenceHandler
+	switch {
+	case joined:
+		handlers = p.onJoin
+	case left:
+		handlers = p.onLeave
+	}
+	p.mu.Unlock()
+
+	for _, h := range handlers {
+		h.fn(copyChatUser(user))
+	}
+}
+
+// change applies an event to the users and reports whether a user joined or
+// left.
+func change(users map[uint]beam.ChatUser, evt interface{}) (joined, left bool, user beam.ChatUser) {
+	switch evt := evt.(type) {
+	case *UserJoin:
+		known, ok := users[evt.ID]
+		joined = !ok
+		user = beam.ChatUser{UserID: evt.ID, UserName: evt.UserName, UserRoles: evt.Roles, Lurking: !ok || known.Lurking}
+		users[evt.ID] = user
+	case *UserLeave:
+		if user, left = users[evt.ID]; left {
+			delete(users, evt.ID)
+		}
+	case *UserUpdate:
+		if known, ok := users[evt.UserID]; ok {
+			if evt.UserName != "" {
+				known.UserName = evt.UserName
+			}
+			if evt.Roles != nil {
+				known.UserRoles = evt.Roles
+			}
+			users[evt.UserID] = known
+		}
+	case *ChatMessage:
+		if known, ok := users[evt.UserID]; ok && known.Lurking {
+			known.Lurking = false
+			users[evt.UserID] = known
+		}
+	}
+
+	return joined, left, user
+}
+
+func copyChatUser(user beam.ChatUser) beam.ChatUser {
+	user.UserRoles = append([]string(nil), user.UserRoles...)
+	return user
+}
@@ -0,0 +1,125 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	beam "gitlab.com/toby3d/mixer"
+)
+
+// fakeSource keeps the handlers registered on it.
+type fakeSource struct {
+	handlers []func(interface{})
+}
+
+func (s *fakeSource) Handle(fn interface{}) func() {
+	s.handlers = append(s.handlers, fn.(func(interface{})))
+	return func() { s.handlers = nil }
+}
+
+func (s *fakeSource) emit(evt interface{}) {
+	for _, h := range s.handlers {
+		h(evt)
+	}
+}
+
+func TestPresenceSeed(t *testing.T) {
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	src := new(fakeSource)
+	mux.HandleFunc("/api/v1/chats/5/users", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "100", r.URL.Query().Get("limit"))
+
+		// Users join, leave and chat while the pages are fetched.
+		if r.URL.Query().Get("page") != "1" {
+			src.emit(&UserJoin{ID: 1, UserName: "early", Roles: []string{"User"}})
+			src.emit(&UserLeave{ID: 101})
+			src.emit(&ChatMessage{User: User{UserID: 102}})
+			src.emit(&UserJoin{ID: 500, UserName: "newcomer", Roles: []string{"User"}})
+		}
+
+		// The first page is full, the second one has the rest.
+		count, lurking := presencePageSize, true
+		if r.URL.Query().Get("page") == "1" {
+			count, lurking = 2, false
+		}
+		users := make([]string, count)
+		for i := range users {
+			id := i + 1
+			if lurking {
+				id += 100
+			}
+			users[i] = fmt.Sprintf(`{"userId":%d,"userName":"user%d","userRoles":["User"],"lurking":%t}`, id, id, lurking && i < 10)
+		}
+		fmt.Fprintf(w, "[%s]", strings.Join(users, ","))
+	})
+
+	env, _ := beam.HostEnvironment(srv.URL)
+	client, _ := beam.NewEnvClient(env, nil)
+
+	p := NewPresence(src)
+	assert.NoError(t, p.Seed(context.Background(), client, 5))
+	assert.Equal(t, presencePageSize+2, p.Count())
+	assert.Equal(t, 9, p.Lurkers())
+
+	_, ok := p.User(101)
+	assert.False(t, ok)
+	user, ok := p.User(103)
+	assert.True(t, ok)
+	assert.Equal(t, "user103", user.UserName)
+	assert.Equal(t, []string{"User"}, user.UserRoles)
+	user, ok = p.User(500)
+	assert.True(t, ok)
+	assert.True(t, user.Lurking)
+	assert.Empty(t, p.pending)
+}
+
+func TestPresenceEvents(t *testing.T) {
+	src := new(fakeSource)
+	p := NewPresence(src)
+
+	var joined, left []string
+	p.OnJoin(func(user beam.ChatUser) { joined = append(joined, user.UserName) })
+	removeLeave := p.OnLeave(func(user beam.ChatUser) { left = append(left, user.UserName) })
+
+	p.users[9] = beam.ChatUser{UserID: 9, UserName: "lurker", Lurking: true}
+	assert.Equal(t, 1, p.Lurkers())
+
+	src.emit(&UserJoin{ID: 1, UserName: "connor", Roles: []string{"User"}})
+	src.emit(&UserJoin{ID: 2, UserName: "matt", Roles: []string{"User"}})
+	src.emit(&UserJoin{ID: 2, UserName: "matt", Roles: []string{"User"}})
+	src.emit(&UserUpdate{UserID: 2, Roles: []string{"User", "Mod"}})
+	src.emit(&UserLeave{ID: 1, UserName: "connor"})
+	src.emit(&UserLeave{ID: 3, UserName: "stranger"})
+	src.emit(&ChatMessage{User: User{UserID: 9, UserName: "lurker"}})
+
+	assert.Equal(t, []string{"connor", "matt"}, joined)
+	assert.Equal(t, []string{"connor"}, left)
+	// matt joined and did not chat yet.
+	assert.Equal(t, 1, p.Lurkers())
+
+	users := p.Users()
+	if assert.Len(t, users, 2) {
+		assert.Equal(t, "lurker", users[0].UserName)
+		assert.Equal(t, []string{"User", "Mod"}, users[1].UserRoles)
+	}
+
+	// Snapshots do not share the roles with the presence.
+	users[1].UserRoles[0] = "Banned"
+	user, _ := p.User(2)
+	assert.Equal(t, "User", user.UserRoles[0])
+
+	removeLeave()
+	src.emit(&UserLeave{ID: 2})
+	assert.Equal(t, []string{"connor"}, left)
+
+	p.Close()
+	assert.Empty(t, src.handlers)
+}
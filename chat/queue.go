@@ -0,0 +1,380 @@
+package chat
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Priorities of the calls sent by a Queue, higher ones are sent first.
+const (
+	PriorityChatter Priority = iota
+	PriorityNormal
+	PriorityModeration
+)
+
+const (
+	// MaxMessageLength is the longest message in runes the server accepts,
+	// longer ones are split by a Queue.
+	MaxMessageLength = 360
+
+	defaultQueueRate  = 500 * time.Millisecond
+	defaultQueueBurst = 5
+)
+
+type (
+	// Priority is the order of a call in a Queue.
+	Priority int
+
+	// Caller is anything calling chat methods, like *Connection or *Client.
+	Caller interface {
+		Call(ctx context.Context, method string, args []interface{}, result interface{}) error
+	}
+
+	// Queue sends calls one by one through a token bucket, so bursts do not
+	// get throttled by the server. Messages and whispers also wait for the
+	// slow chat of the channel unless the roles of the bot are exempt, and
+	// are split in parts the server accepts. Calls are sent by priority, in
+	// the order they were queued within the same priority. It is safe for
+	// concurrent use.
+	Queue struct {
+		caller Caller
+
+		// The time to earn a token and the size of the bucket, which holds
+		// at least one token. They are read by Run without locking, so set
+		// them before calling it.
+		Rate  time.Duration
+		Burst int
+
+		mu       sync.Mutex
+		items    [][]*queueItem
+		slowChat time.Duration
+		exempt   bool
+		tokens   float64
+		filled   time.Time
+		lastMsg  time.Time
+		wake     chan struct{}
+	}
+
+	// Sent is the result of a queued call.
+	Sent struct {
+		done     chan struct{}
+		messages []*ChatMessage
+		err      error
+		parts    int
+	}
+
+	queueItem struct {
+		method string
+		args   []interface{}
+		sent   *Sent
+	}
+)
+
+// NewQueue returns a queue sending through the caller. Call Run to start
+// sending.
+func NewQueue(caller Caller) *Queue {
+	return &Queue{
+		caller: caller,
+		Rate:   defaultQueueRate,
+		Burst:  defaultQueueBurst,
+		tokens: defaultQueueBurst,
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+// SetSlowChat sets the time between messages of the channel, see the
+// ChannelSlowchat preference in milliseconds.
+func (q *Queue) SetSlowChat(d time.Duration) {
+	q.mu.Lock()
+	q.slowChat = d
+	q.mu.Unlock()
+	q.notify()
+}
+
+// SetRoles sets the roles of the bot in the channel, like the ones returned
+// by Join. Moderators and the roles above them, and channel editors, skip the
+// slow chat.
+func (q *Queue) SetRoles(roles []string) {
+	exempt := HighestRole(roles).AtLeast(RoleMod) || hasAnyRole(roles, []string{"ChannelEditor"})
+
+	q.mu.Lock()
+	q.exempt = exempt
+	q.mu.Unlock()
+	q.notify()
+}
+
+// Msg queues a message to the chat, split in parts if it is too long. A blank
+// message is not sent.
+func (q *Queue) Msg(priority Priority, message string) *Sent {
+	parts := splitMessage(message, MaxMessageLength)
+	args := make([][]interface{}, len(parts))
+	for i, part := range parts {
+		args[i] = []interface{}{part}
+	}
+
+	return q.push(priority, "msg", args)
+}
+
+// Whisper queues a message to the user, split in parts if it is too long. A
+// blank message is not sent.
+func (q *Queue) Whisper(priority Priority, targetUsername, message string) *Sent {
+	parts := splitMessage(message, MaxMessageLength)
+	args := make([][]interface{}, len(parts))
+	for i, part := range parts {
+		args[i] = []interface{}{targetUsername, part}
+	}
+
+	return q.push(priority, "whisper", args)
+}
+
+// Call queues any other method, like "timeout" or "deleteMessage" with
+// PriorityModeration.
+func (q *Queue) Call(priority Priority, method string, args ...interface{}) *Sent {
+	return q.push(priority, method, [][]interface{}{args})
+}
+
+// Len returns the number of calls waiting to be sent.
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var n int
+	for _, items := range q.items {
+		n += len(items)
+	}
+	return n
+}
+
+// Run sends the queued calls until ctx is done. The calls left are failed
+// with the error of ctx.
+func (q *Queue) Run(ctx context.Context) error {
+	for {
+		item, wait := q.next(time.Now())
+		if item != nil {
+			q.send(ctx, item)
+			continue
+		}
+
+		var timer *time.Timer
+		var expired <-chan time.Time
+		if wait > 0 {
+			timer = time.NewTimer(wait)
+			expired = timer.C
+		}
+
+		select {
+		case <-q.wake:
+		case <-expired:
+		case <-ctx.Done():
+			q.drain(ctx.Err())
+			return ctx.Err()
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+func (q *Queue) push(priority Priority, method string, args [][]interface{}) *Sent {
+	if priority < PriorityChatter {
+		priority = PriorityChatter
+	}
+	sent := &Sent{done: make(chan struct{}), parts: len(args)}
+
+	if len(args) == 0 {
+		close(sent.done)
+		return sent
+	}
+
+	q.mu.Lock()
+	for len(q.items) <= int(priority) {
+		q.items = append(q.items, nil)
+	}
+	for _, arg := range args {
+		q.items[priority] = append(q.items[priority], &queueItem{method: method, args: arg, sent: sent})
+	}
+	q.mu.Unlock()
+	q.notify()
+
+	return sent
+}
+
+func (q *Queue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// next takes the call to send now, or returns how long to wait for one. A
+// zero wait means the queue is empty.
+func (q *Queue) next(now time.Time) (*queueItem, time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.refill(now)
+
+	for p := len(q.items) - 1; p >= 0; p-- {
+		// Skip the rest of a call which already failed.
+		for len(q.items[p]) > 0 && q.items[p][0].sent.failed() {
+			q.items[p] = q.items[p][1:]
+		}
+		if len(q.items[p]) == 0 {
+			continue
+		}
+
+		item := q.items[p][0]
+		wait := q.delay(now, item)
+		if wait > 0 {
+			return nil, wait
+		}
+
+		q.items[p] = q.items[p][1:]
+		q.tokens--
+		if isMessage(item.method) {
+			q.lastMsg = now
+		}
+		return item, 0
+	}
+
+	return nil, 0
+}
+
+func (q *Queue) refill(now time.Time) {
+	if !q.filled.IsZero() && q.Rate > 0 {
+		q.tokens += float64(now.Sub(q.filled)) / float64(q.Rate)
+	}
+	burst := float64(q.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+	if q.tokens > burst || q.Rate <= 0 {
+		q.tokens = burst
+	}
+	q.filled = now
+}
+
+// delay returns how long the call has to wait for a token and the slow chat.
+func (q *Queue) delay(now time.Time, item *queueItem) time.Duration {
+	var wait time.Duration
+	if q.tokens < 1 {
+		wait = time.Duration((1 - q.tokens) * float64(q.Rate))
+	}
+	if isMessage(item.method) && !q.exempt && !q.lastMsg.IsZero() {
+		if slow := q.lastMsg.Add(q.slowChat).Sub(now); slow > wait {
+			wait = slow
+		}
+	}
+	return wait
+}
+
+func (q *Queue) send(ctx context.Context, item *queueItem) {
+	var msg *ChatMessage
+	var result interface{}
+	if isMessage(item.method) {
+		msg = new(ChatMessage)
+		result = msg
+	}
+
+	err := q.caller.Call(ctx, item.method, item.args, result)
+	item.sent.finish(msg, err)
+}
+
+func (q *Queue) drain(err error) {
+	q.mu.Lock()
+	items := q.items
+	q.items = nil
+	q.mu.Unlock()
+
+	for _, list := range items {
+		for _, item := range list {
+			item.sent.finish(nil, err)
+		}
+	}
+}
+
+func isMessage(method string) bool {
+	return method == "msg" || method == "whisper"
+}
+
+// Done returns a channel which is closed once every part of the call is sent
+// or the call failed.
+func (s *Sent) Done() <-chan struct{} {
+	return s.done
+}
+
+// Wait waits for the call and returns the messages as parsed by the server,
+// one per part, or the error of the first part which failed.
+func (s *Sent) Wait(ctx context.Context) ([]*ChatMessage, error) {
+	select {
+	case <-s.done:
+		return s.messages, s.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (s *Sent) failed() bool {
+	select {
+	case <-s.done:
+		return s.err != nil
+	default:
+		return false
+	}
+}
+
+// finish records the result of a part, called by the Run goroutine only.
+func (s *Sent) finish(msg *ChatMessage, err error) {
+	select {
+	case <-s.done:
+		return
+	default:
+	}
+
+	if err != nil {
+		s.err = err
+		close(s.done)
+		return
+	}
+	if msg != nil {
+		s.messages = append(s.messages, msg)
+	}
+	if s.parts--; s.parts == 0 {
+		close(s.done)
+	}
+}
+
+// splitMessage splits the message in parts of at most max runes, at spaces
+// when possible. Blank parts are skipped.
+func splitMessage(message string, max int) []string {
+	var parts []string
+	for utf8.RuneCountInString(message) > max {
+		// The byte offset of the rune after the longest part.
+		cut := 0
+		for i := 0; i < max; i++ {
+			_, size := utf8.DecodeRuneInString(message[cut:])
+			cut += size
+		}
+
+		part := message[:cut]
+		if i := strings.LastIndexByte(part, ' '); i > 0 {
+			part = message[:i]
+			cut = i + 1
+		}
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+		message = strings.TrimLeft(message[cut:], " ")
+	}
+	if strings.TrimSpace(message) == "" {
+		return parts
+	}
+	if len(parts) > 0 {
+		message = strings.TrimRight(message, " ")
+	}
+
+	return append(parts, message)
+}
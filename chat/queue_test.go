@@ -0,0 +1,202 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type call struct {
+	method string
+	args   []interface{}
+	at     time.Time
+}
+
+// fakeCaller records the calls and fails the ones with an argument "fail".
+type fakeCaller struct {
+	mu    sync.Mutex
+	calls []call
+}
+
+func (f *fakeCaller) Call(ctx context.Context, method string, args []interface{}, result interface{}) error {
+	f.mu.Lock()
+	f.calls = append(f.calls, call{method, args, time.Now()})
+	f.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if len(args) > 0 && args[len(args)-1] == "fail" {
+		return errors.New("failed")
+	}
+	if msg, ok := result.(*ChatMessage); ok {
+		msg.Message.Message = []MessageSegment{{Type: SegmentText, Text: args[len(args)-1].(string)}}
+	}
+	return nil
+}
+
+func (f *fakeCaller) recorded() []call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]call(nil), f.calls...)
+}
+
+func runQueue(q *Queue) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		q.Run(ctx)
+		close(done)
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+func TestQueuePriorities(t *testing.T) {
+	caller := new(fakeCaller)
+	q := NewQueue(caller)
+
+	chatter := q.Msg(PriorityChatter, "hello")
+	normal := q.Whisper(PriorityNormal, "connor", "hi")
+	timeout := q.Call(PriorityModeration, "timeout", "spammer", "5m")
+	assert.Equal(t, 3, q.Len())
+
+	stop := runQueue(q)
+	defer stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	msgs, err := chatter.Wait(ctx)
+	assert.NoError(t, err)
+	if assert.Len(t, msgs, 1) {
+		assert.Equal(t, "hello", msgs[0].Message.PlainText())
+	}
+	_, err = normal.Wait(ctx)
+	assert.NoError(t, err)
+	msgs, err = timeout.Wait(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, msgs)
+
+	calls := caller.recorded()
+	if assert.Len(t, calls, 3) {
+		assert.Equal(t, "timeout", calls[0].method)
+		assert.Equal(t, []interface{}{"connor", "hi"}, calls[1].args)
+		assert.Equal(t, "msg", calls[2].method)
+	}
+}
+
+func TestQueueLimits(t *testing.T) {
+	q := NewQueue(new(fakeCaller))
+	q.Rate = 20 * time.Millisecond
+	q.Burst = 1
+	q.SetSlowChat(60 * time.Millisecond)
+
+	// next is given the time by Run, so a fake clock drives it here.
+	start := time.Now()
+	next := func(elapsed time.Duration) (string, time.Duration) {
+		item, wait := q.next(start.Add(elapsed))
+		if item == nil {
+			return "", wait
+		}
+		return item.method, wait
+	}
+
+	// Messages wait for the slow chat, other calls for a token only.
+	q.Msg(PriorityChatter, "one")
+	q.Call(PriorityChatter, "ping")
+	q.Msg(PriorityChatter, "two")
+
+	method, _ := next(0)
+	assert.Equal(t, "msg", method)
+	_, wait := next(0)
+	assert.Equal(t, 20*time.Millisecond, wait)
+	method, _ = next(20 * time.Millisecond)
+	assert.Equal(t, "ping", method)
+	_, wait = next(20 * time.Millisecond)
+	assert.Equal(t, 40*time.Millisecond, wait)
+	method, _ = next(60 * time.Millisecond)
+	assert.Equal(t, "msg", method)
+
+	// Moderators skip the slow chat.
+	q.SetRoles([]string{"User", "Mod"})
+	q.Msg(PriorityChatter, "three")
+	method, _ = next(80 * time.Millisecond)
+	assert.Equal(t, "msg", method)
+	_, wait = next(80 * time.Millisecond)
+	assert.Equal(t, time.Duration(0), wait)
+	assert.Equal(t, 0, q.Len())
+
+	// The bucket holds a token even without a burst.
+	q.Burst = 0
+	q.Call(PriorityChatter, "ping")
+	method, _ = next(100 * time.Millisecond)
+	assert.Equal(t, "ping", method)
+}
+
+func TestQueueSplitsAndFails(t *testing.T) {
+	caller := new(fakeCaller)
+	q := NewQueue(caller)
+
+	long := strings.Repeat("word ", 100)
+	sent := q.Msg(PriorityNormal, long)
+	failed := q.Msg(PriorityNormal, strings.Repeat("x", MaxMessageLength)+" fail "+strings.Repeat("y", MaxMessageLength))
+
+	stop := runQueue(q)
+	defer stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	msgs, err := sent.Wait(ctx)
+	assert.NoError(t, err)
+	if assert.Len(t, msgs, 2) {
+		assert.Equal(t, strings.TrimSpace(long), msgs[0].Message.PlainText()+" "+msgs[1].Message.PlainText())
+	}
+
+	_, err = failed.Wait(ctx)
+	assert.EqualError(t, err, "failed")
+	// The part after the failed one is dropped.
+	assert.Len(t, caller.recorded(), 4)
+}
+
+func TestQueueDrains(t *testing.T) {
+	caller := new(fakeCaller)
+	q := NewQueue(caller)
+	q.SetSlowChat(time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- q.Run(ctx) }()
+
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer waitCancel()
+
+	_, err := q.Msg(PriorityChatter, "sent").Wait(waitCtx)
+	assert.NoError(t, err)
+	held := q.Msg(PriorityChatter, "held")
+
+	cancel()
+	assert.Equal(t, context.Canceled, <-done)
+	_, err = held.Wait(waitCtx)
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestSplitMessage(t *testing.T) {
+	assert.Equal(t, []string{"short"}, splitMessage("short", 10))
+	assert.Equal(t, []string{"hello", "world"}, splitMessage("hello world", 8))
+	assert.Equal(t, []string{"абвгд", "еж"}, splitMessage("абвгдеж", 5))
+	assert.Equal(t, []string{"hello", "world"}, splitMessage("hello         world", 8))
+	assert.Empty(t, splitMessage(" \t ", 10))
+	assert.Empty(t, splitMessage(strings.Repeat(" ", 30), 10))
+
+	_, err := NewQueue(new(fakeCaller)).Msg(PriorityChatter, "  ").Wait(context.Background())
+	assert.NoError(t, err)
+}
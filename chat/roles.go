@@ -0,0 +1,114 @@
+package chat
+
+import "fmt"
+
+// Chat roles, from the lowest precedence to the highest. RoleUnknown is the
+// zero value, it is no role and only marks a Role field as unset.
+const (
+	RoleUnknown Role = iota
+	RoleBanned
+	RoleUser
+	RolePro
+	RoleSubscriber
+	RoleMod
+	RoleGlobalMod
+	RoleStaff
+	RoleFounder
+	RoleOwner
+)
+
+// Role is a chat role. Roles compare by precedence, a role has every
+// permission of the roles below it.
+type Role int
+
+var roleNames = [...]string{
+	RoleBanned:     "Banned",
+	RoleUser:       "User",
+	RolePro:        "Pro",
+	RoleSubscriber: "Subscriber",
+	RoleMod:        "Mod",
+	RoleGlobalMod:  "GlobalMod",
+	RoleStaff:      "Staff",
+	RoleFounder:    "Founder",
+	RoleOwner:      "Owner",
+}
+
+// MethodRoles are the lowest roles allowed to call chat methods, by method
+// name. Methods which are not listed need RoleUser.
+var MethodRoles = map[string]Role{
+	"timeout":        RoleMod,
+	"purge":          RoleMod,
+	"deleteMessage":  RoleMod,
+	"clearMessages":  RoleMod,
+	"vote:start":     RoleMod,
+	"giveaway:start": RoleMod,
+}
+
+// ParseRole returns the role of a name sent by the server, like "Owner". It
+// returns RoleUser with the error of an unknown name.
+func ParseRole(name string) (Role, error) {
+	for role, roleName := range roleNames {
+		if Role(role) != RoleUnknown && roleName == name {
+			return Role(role), nil
+		}
+	}
+
+	return RoleUser, fmt.Errorf("chat: unknown role %q", name)
+}
+
+// HighestRole returns the role of highest precedence of the names, like the
+// UserRoles of a message or the Roles of AuthReply. Banned users are
+// RoleBanned whatever other roles they have, unknown names are skipped and
+// RoleUser is returned if none is known.
+func HighestRole(names []string) Role {
+	highest := RoleUser
+	for _, name := range names {
+		role, err := ParseRole(name)
+		if err != nil {
+			continue
+		}
+		if role == RoleBanned {
+			return RoleBanned
+		}
+		if role > highest {
+			highest = role
+		}
+	}
+
+	return highest
+}
+
+// String returns the name of the role sent by the server.
+func (r Role) String() string {
+	if r <= RoleUnknown || int(r) >= len(roleNames) {
+		return fmt.Sprintf("Role(%d)", int(r))
+	}
+
+	return roleNames[r]
+}
+
+// AtLeast reports whether the role has the precedence of min or higher.
+func (r Role) AtLeast(min Role) bool {
+	return r >= min
+}
+
+// Can reports whether the role is allowed to call the chat method. Banned
+// users can call nothing.
+func (r Role) Can(method string) bool {
+	min, ok := MethodRoles[method]
+	if !ok || min < RoleUser {
+		min = RoleUser
+	}
+
+	return r.AtLeast(min)
+}
+
+// Role returns the highest role of the user.
+func (u *User) Role() Role {
+	return HighestRole(u.UserRoles)
+}
+
+// Role returns the highest role granted by the server.
+func (a *AuthReply) Role() Role {
+	return HighestRole(a.Roles)
+}
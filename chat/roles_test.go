@@ -0,0 +1,53 @@
+package chat
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoles(t *testing.T) {
+	role, err := ParseRole("GlobalMod")
+	assert.NoError(t, err)
+	assert.Equal(t, RoleGlobalMod, role)
+	_, err = ParseRole("Emperor")
+	assert.Error(t, err)
+
+	assert.Equal(t, RoleOwner, HighestRole([]string{"User", "Subscriber", "Owner", "ChannelEditor"}))
+	assert.Equal(t, RoleUser, HighestRole(nil))
+	assert.Equal(t, RoleBanned, HighestRole([]string{"Pro", "Banned"}))
+	assert.Equal(t, "Mod", RoleMod.String())
+
+	assert.True(t, RoleFounder.AtLeast(RoleStaff))
+	assert.False(t, RoleSubscriber.AtLeast(RoleMod))
+
+	assert.True(t, RoleMod.Can("timeout"))
+	assert.False(t, RolePro.Can("purge"))
+	assert.True(t, RoleUser.Can("msg"))
+	assert.False(t, RoleBanned.Can("msg"))
+	assert.False(t, RoleUnknown.Can("msg"))
+	assert.False(t, RoleUnknown.AtLeast(RoleBanned))
+	assert.Equal(t, "Role(0)", RoleUnknown.String())
+	_, err = ParseRole("")
+	assert.Error(t, err)
+
+	user := &User{UserRoles: []string{"User", "Mod"}}
+	assert.Equal(t, RoleMod, user.Role())
+	assert.Equal(t, RoleOwner, (&AuthReply{Roles: []string{"Owner"}}).Role())
+}
+
+func TestRouterMinRole(t *testing.T) {
+	caller := new(fakeCaller)
+	r := NewRouter("!")
+
+	var runs int
+	r.Add(&Command{Name: "clear", MinRole: RoleMod, Handler: func(ctx context.Context, inv *Invocation) error {
+		runs++
+		return nil
+	}})
+
+	r.Run(caller, chatMessage("matt", []string{"User", "Subscriber"}, "!clear"))
+	r.Run(caller, chatMessage("connor", []string{"User", "GlobalMod"}, "!clear"))
+	assert.Equal(t, 1, runs)
+}
@@ -0,0 +1,358 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+const defaultCommandTimeout = 10 * time.Second
+
+var (
+	// ErrForbidden is passed to the error handler of a Router when the author
+	// has none of the roles of a command.
+	ErrForbidden = errors.New("chat: command forbidden")
+
+	// ErrCooldown is passed to the error handler of a Router when a command
+	// is used again before its cooldown ends.
+	ErrCooldown = errors.New("chat: command on cooldown")
+)
+
+type (
+	// CommandHandler runs a command. The context ends after the Timeout of
+	// the router.
+	CommandHandler func(ctx context.Context, inv *Invocation) error
+
+	// Middleware wraps the handlers of every command of a router.
+	Middleware func(CommandHandler) CommandHandler
+
+	// Command is a chat command like "!timeout <user> <duration>".
+	Command struct {
+		// The name and the other names of the command, without the prefix.
+		Name    string
+		Aliases []string
+
+		// The arguments and what the command does, shown by the help.
+		Usage       string
+		Description string
+
+		// The roles which may run the command, anyone if empty.
+		Roles []string
+
+		// The lowest role which may run the command, checked with Roles.
+		// RoleUser if unset, so banned users can not run it.
+		MinRole Role
+
+		// The time to wait between two runs of the command.
+		Cooldown time.Duration
+
+		// The fewest arguments the command needs, a *UsageError is passed to
+		// the error handler if there are less.
+		MinArgs int
+
+		Handler CommandHandler
+	}
+
+	// Invocation is a command run by a chat message.
+	Invocation struct {
+		Command *Command
+
+		// The name the command was called by, which may be an alias.
+		Name string
+
+		// The arguments after the name, split at spaces unless quoted.
+		Args []string
+
+		Message *ChatMessage
+
+		// The connection or client the message came from.
+		Caller Caller
+	}
+
+	// UsageError is passed to the error handler of a Router when a command
+	// gets too few arguments.
+	UsageError struct {
+		Prefix  string
+		Command *Command
+	}
+
+	// Router runs the commands of chat messages starting with the prefix.
+	// A help command is registered by default. A Router literal works like
+	// one made by NewRouter, without the help command. It is safe for
+	// concurrent use.
+	Router struct {
+		Prefix string
+
+		// The time a command may run for, defaultCommandTimeout if zero.
+		Timeout time.Duration
+
+		// OnError is called with the errors of commands and of the checks
+		// before them, like ErrForbidden. The errors are dropped if nil.
+		OnError func(inv *Invocation, err error)
+
+		mu         sync.Mutex
+		commands   map[string]*Command
+		names      []string
+		middleware []Middleware
+		lastRun    map[*Command]time.Time
+	}
+)
+
+// NewRouter returns a router of the commands starting with prefix, like "!".
+func NewRouter(prefix string) *Router {
+	r := &Router{
+		Prefix:   prefix,
+		Timeout:  defaultCommandTimeout,
+		commands: make(map[string]*Command),
+		lastRun:  make(map[*Command]time.Time),
+	}
+	r.Add(&Command{
+		Name:        "help",
+		Usage:       "[command]",
+		Description: "Lists the commands or shows how to use one.",
+		Handler:     r.help,
+	})
+
+	return r
+}
+
+// Add registers the command by its name and aliases. It fails if one of them
+// is taken, or if the command has no handler.
+func (r *Router) Add(cmd *Command) error {
+	if cmd.Handler == nil {
+		return fmt.Errorf("chat: command %q has no handler", cmd.Name)
+	}
+	names := append([]string{cmd.Name}, cmd.Aliases...)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.commands == nil {
+		r.commands = make(map[string]*Command)
+	}
+	for _, name := range names {
+		if _, ok := r.commands[strings.ToLower(name)]; ok {
+			return fmt.Errorf("chat: command %q already exists", name)
+		}
+	}
+	for _, name := range names {
+		r.commands[strings.ToLower(name)] = cmd
+	}
+	r.names = append(r.names, cmd.Name)
+	sort.Strings(r.names)
+
+	return nil
+}
+
+// Use adds middleware around the handlers of every command, the first one
+// is the outermost.
+func (r *Router) Use(mw ...Middleware) {
+	r.mu.Lock()
+	r.middleware = append(r.middleware, mw...)
+	r.mu.Unlock()
+}
+
+// Handler returns a handler of chat messages which runs their commands and
+// replies through the caller, like:
+//
+//	conn.Handle(router.Handler(conn))
+func (r *Router) Handler(caller Caller) func(*ChatMessage) {
+	return func(msg *ChatMessage) {
+		r.Run(caller, msg)
+	}
+}
+
+// Run runs the command of the message, if any. It reports whether the
+// message was a known command.
+func (r *Router) Run(caller Caller, msg *ChatMessage) bool {
+	text := strings.TrimSpace(msg.Message.PlainText())
+	if r.Prefix == "" || !strings.HasPrefix(text, r.Prefix) {
+		return false
+	}
+
+	args := splitArgs(strings.TrimPrefix(text, r.Prefix))
+	if len(args) == 0 {
+		return false
+	}
+
+	r.mu.Lock()
+	cmd, ok := r.commands[strings.ToLower(args[0])]
+	middleware := r.middleware
+	r.mu.Unlock()
+	if !ok {
+		return false
+	}
+
+	inv := &Invocation{
+		Command: cmd,
+		Name:    args[0],
+		Args:    args[1:],
+		Message: msg,
+		Caller:  caller,
+	}
+
+	err := r.check(inv)
+	if err == nil {
+		handler := cmd.Handler
+		for i := len(middleware) - 1; i >= 0; i-- {
+			handler = middleware[i](handler)
+		}
+
+		timeout := r.Timeout
+		if timeout <= 0 {
+			timeout = defaultCommandTimeout
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		err = handler(ctx, inv)
+		cancel()
+	}
+	if err != nil && r.OnError != nil {
+		r.OnError(inv, err)
+	}
+
+	return true
+}
+
+// check returns why the invocation may not run, or starts the cooldown.
+func (r *Router) check(inv *Invocation) error {
+	if !allowed(&inv.Message.User, inv.Command) {
+		return ErrForbidden
+	}
+	if len(inv.Args) < inv.Command.MinArgs {
+		return &UsageError{Prefix: r.Prefix, Command: inv.Command}
+	}
+
+	if inv.Command.Cooldown > 0 {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		now := time.Now()
+		if last, ok := r.lastRun[inv.Command]; ok && now.Sub(last) < inv.Command.Cooldown {
+			return ErrCooldown
+		}
+		if r.lastRun == nil {
+			r.lastRun = make(map[*Command]time.Time)
+		}
+		r.lastRun[inv.Command] = now
+	}
+
+	return nil
+}
+
+// help lists the commands the author may run, or shows the usage of one.
+func (r *Router) help(ctx context.Context, inv *Invocation) error {
+	if len(inv.Args) > 0 {
+		r.mu.Lock()
+		cmd, ok := r.commands[strings.ToLower(strings.TrimPrefix(inv.Args[0], r.Prefix))]
+		r.mu.Unlock()
+		if !ok {
+			return inv.Reply(ctx, "unknown command "+inv.Args[0])
+		}
+		return inv.Reply(ctx, describe(r.Prefix, cmd))
+	}
+
+	var names []string
+	r.mu.Lock()
+	for _, name := range r.names {
+		if cmd := r.commands[strings.ToLower(name)]; allowed(&inv.Message.User, cmd) {
+			names = append(names, r.Prefix+name)
+		}
+	}
+	r.mu.Unlock()
+
+	return inv.Reply(ctx, "commands: "+strings.Join(names, ", "))
+}
+
+// Reply answers the author, by a whisper if the command was whispered.
+func (inv *Invocation) Reply(ctx context.Context, message string) error {
+	if inv.Message.Target != "" || inv.Message.Message.Meta.Whisper {
+		return inv.Whisper(ctx, message)
+	}
+
+	return inv.Caller.Call(ctx, "msg", []interface{}{"@" + inv.Message.UserName + " " + message}, nil)
+}
+
+// Whisper answers the author by a whisper.
+func (inv *Invocation) Whisper(ctx context.Context, message string) error {
+	return inv.Caller.Call(ctx, "whisper", []interface{}{inv.Message.UserName, message}, nil)
+}
+
+// Error implements the error interface.
+func (e *UsageError) Error() string {
+	return "usage: " + e.Prefix + e.Command.Name + " " + e.Command.Usage
+}
+
+func describe(prefix string, cmd *Command) string {
+	text := prefix + cmd.Name
+	if cmd.Usage != "" {
+		text += " " + cmd.Usage
+	}
+	if cmd.Description != "" {
+		text += " - " + cmd.Description
+	}
+	if len(cmd.Aliases) > 0 {
+		text += " (also " + prefix + strings.Join(cmd.Aliases, ", "+prefix) + ")"
+	}
+
+	return text
+}
+
+// allowed reports whether the user has the roles to run the command.
+func allowed(user *User, cmd *Command) bool {
+	min := cmd.MinRole
+	if min == RoleUnknown {
+		min = RoleUser
+	}
+	return user.Role().AtLeast(min) && hasAnyRole(user.UserRoles, cmd.Roles)
+}
+
+func hasAnyRole(roles, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, role := range roles {
+		for _, a := range allowed {
+			if role == a {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// splitArgs splits the text at spaces, keeping the double quoted parts
+// together.
+func splitArgs(text string) []string {
+	var (
+		args   []string
+		arg    []rune
+		quoted bool
+		inArg  bool
+	)
+	for _, r := range text {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			inArg = true
+		case unicode.IsSpace(r) && !quoted:
+			if inArg {
+				args = append(args, string(arg))
+				arg, inArg = arg[:0], false
+			}
+		default:
+			arg = append(arg, r)
+			inArg = true
+		}
+	}
+	if inArg {
+		args = append(args, string(arg))
+	}
+
+	return args
+}
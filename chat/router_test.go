@@ -0,0 +1,148 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func chatMessage(user string, roles []string, text string) *ChatMessage {
+	msg := &ChatMessage{User: User{UserName: user, UserRoles: roles}}
+	msg.Message.Message = []MessageSegment{{Type: SegmentText, Text: text}}
+	return msg
+}
+
+func TestRouter(t *testing.T) {
+	caller := new(fakeCaller)
+	r := NewRouter("!")
+
+	var timedOut []string
+	assert.NoError(t, r.Add(&Command{
+		Name:        "timeout",
+		Aliases:     []string{"to"},
+		Usage:       "<user> <duration>",
+		Description: "Times a user out.",
+		Roles:       []string{"Owner", "Mod"},
+		MinArgs:     2,
+		Handler: func(ctx context.Context, inv *Invocation) error {
+			timedOut = append(timedOut, inv.Args...)
+			return inv.Reply(ctx, "done")
+		},
+	}))
+	assert.Error(t, r.Add(&Command{Name: "TO", Handler: func(context.Context, *Invocation) error { return nil }}))
+	assert.Error(t, r.Add(&Command{Name: "nothing"}))
+
+	var errs []error
+	r.OnError = func(inv *Invocation, err error) { errs = append(errs, err) }
+
+	var order []string
+	r.Use(func(next CommandHandler) CommandHandler {
+		return func(ctx context.Context, inv *Invocation) error {
+			order = append(order, "outer:"+inv.Name)
+			return next(ctx, inv)
+		}
+	}, func(next CommandHandler) CommandHandler {
+		return func(ctx context.Context, inv *Invocation) error {
+			order = append(order, "inner")
+			return next(ctx, inv)
+		}
+	})
+
+	handle := r.Handler(caller)
+	handle(chatMessage("connor", []string{"User", "Mod"}, `!TO spammer "5 m"`))
+	assert.Equal(t, []string{"spammer", "5 m"}, timedOut)
+	assert.Equal(t, []string{"outer:TO", "inner"}, order)
+
+	assert.True(t, r.Run(caller, chatMessage("matt", []string{"User"}, "!timeout connor 1m")))
+	assert.True(t, r.Run(caller, chatMessage("connor", []string{"Owner"}, "!timeout connor")))
+	assert.False(t, r.Run(caller, chatMessage("connor", []string{"Owner"}, "!unknown")))
+	assert.False(t, r.Run(caller, chatMessage("connor", []string{"Owner"}, "timeout a b")))
+
+	if assert.Len(t, errs, 2) {
+		assert.Equal(t, ErrForbidden, errs[0])
+		assert.EqualError(t, errs[1], "usage: !timeout <user> <duration>")
+	}
+
+	calls := caller.recorded()
+	if assert.Len(t, calls, 1) {
+		assert.Equal(t, "msg", calls[0].method)
+		assert.Equal(t, []interface{}{"@connor done"}, calls[0].args)
+	}
+}
+
+func TestRouterCooldownAndHelp(t *testing.T) {
+	caller := new(fakeCaller)
+	r := NewRouter("!")
+
+	var runs int
+	r.Add(&Command{
+		Name:     "dice",
+		Cooldown: 50 * time.Millisecond,
+		Handler: func(ctx context.Context, inv *Invocation) error {
+			runs++
+			return errors.New("rolled off the table")
+		},
+	})
+	r.Add(&Command{Name: "ban", Roles: []string{"Owner"}, Handler: func(context.Context, *Invocation) error { return nil }})
+
+	var errs []error
+	r.OnError = func(inv *Invocation, err error) { errs = append(errs, err) }
+
+	r.Run(caller, chatMessage("connor", nil, "!dice"))
+	r.Run(caller, chatMessage("matt", nil, "!dice"))
+	time.Sleep(60 * time.Millisecond)
+	r.Run(caller, chatMessage("matt", nil, "!dice"))
+	assert.Equal(t, 2, runs)
+	if assert.Len(t, errs, 3) {
+		assert.EqualError(t, errs[0], "rolled off the table")
+		assert.Equal(t, ErrCooldown, errs[1])
+	}
+
+	r.Run(caller, chatMessage("matt", []string{"User"}, "!help"))
+	r.Run(caller, chatMessage("matt", []string{"User"}, "!help !help"))
+	whisper := chatMessage("matt", []string{"User"}, "!help dice")
+	whisper.Target = "bot"
+	r.Run(caller, whisper)
+
+	calls := caller.recorded()
+	if assert.Len(t, calls, 3) {
+		assert.Equal(t, []interface{}{"@matt commands: !dice, !help"}, calls[0].args)
+		assert.Equal(t, []interface{}{"@matt !help [command] - Lists the commands or shows how to use one."}, calls[1].args)
+		assert.Equal(t, "whisper", calls[2].method)
+		assert.Equal(t, []interface{}{"matt", "!dice"}, calls[2].args)
+	}
+}
+
+func TestRouterLiteral(t *testing.T) {
+	caller := new(fakeCaller)
+	r := &Router{Prefix: "!"}
+
+	var deadline bool
+	assert.NoError(t, r.Add(&Command{
+		Name:     "ping",
+		Cooldown: time.Minute,
+		Handler: func(ctx context.Context, inv *Invocation) error {
+			_, deadline = ctx.Deadline()
+			return inv.Reply(ctx, "pong")
+		},
+	}))
+
+	var errs []error
+	r.OnError = func(inv *Invocation, err error) { errs = append(errs, err) }
+
+	// Banned users may not run commands without a MinRole.
+	assert.True(t, r.Run(caller, chatMessage("troll", []string{"User", "Banned"}, "!ping")))
+	assert.True(t, r.Run(caller, chatMessage("connor", []string{"User"}, "!ping")))
+	assert.True(t, r.Run(caller, chatMessage("connor", []string{"User"}, "!ping")))
+	assert.True(t, deadline)
+	assert.Equal(t, []error{ErrForbidden, ErrCooldown}, errs)
+	assert.Len(t, caller.recorded(), 1)
+}
+
+func TestSplitArgs(t *testing.T) {
+	assert.Equal(t, []string{"a", "b c", "", "d"}, splitArgs(` a  "b c" "" d `))
+	assert.Empty(t, splitArgs("   "))
+}
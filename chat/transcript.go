@@ -0,0 +1,356 @@
+package chat
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	ffjson "github.com/pquerna/ffjson/ffjson"
+)
+
+// Directions of the frames of a transcript.
+const (
+	DirectionIn  Direction = "in"
+	DirectionOut Direction = "out"
+)
+
+const (
+	// rotatedLayout is the time layout of the suffix of rotated transcripts.
+	rotatedLayout = "20060102T150405.000000000"
+
+	// recorderBacklog is the number of tapped frames a Recorder keeps while
+	// writing, more are dropped.
+	recorderBacklog = 4096
+)
+
+// ErrRecorderBehind is passed to the error handler of a Recorder when a frame
+// is dropped because the frames before it are still being written.
+var ErrRecorderBehind = errors.New("chat: recorder behind, frame dropped")
+
+type (
+	// Direction tells whether a frame was received or sent.
+	Direction string
+
+	// Record is a line of a transcript.
+	Record struct {
+		Time      time.Time `json:"time"`
+		Direction Direction `json:"dir"`
+
+		// The Method, Reply or Event frame as it was on the socket.
+		Frame json.RawMessage `json:"frame"`
+	}
+
+	// FrameSource is anything passing the frames of a socket to taps, like
+	// *Connection or *Client.
+	FrameSource interface {
+		Tap(fn func(dir Direction, frame []byte)) (remove func())
+	}
+
+	// Recorder writes the frames of connections to a transcript file, one
+	// JSON Record per line. The file is rotated when it grows over MaxSize or
+	// gets older than MaxAge: it is renamed with the time of the rotation as
+	// suffix, like "chat.log.20170102T150405.000000000", and a new file is
+	// started. The tapped frames are written by a goroutine of the recorder,
+	// so the connections do not wait for the disk. It is safe for concurrent
+	// use.
+	Recorder struct {
+		// The file to write to.
+		Path string
+
+		// The size in bytes and the age to rotate the file at, never if zero.
+		MaxSize int64
+		MaxAge  time.Duration
+
+		// OnError is called from the goroutine of the recorder with the
+		// errors of writing and rotating the tapped frames, which are dropped
+		// if nil. The frame is lost if it could not be written.
+		OnError func(err error)
+
+		mu     sync.Mutex
+		file   *os.File
+		size   int64
+		opened time.Time
+
+		queueMu sync.Mutex
+		queue   []*Record
+		dropped bool
+		closed  bool
+		wake    chan struct{}
+		stopped chan struct{}
+	}
+
+	// Replayer passes the events of a transcript to its handlers, like a
+	// connection would. It is an EventSource, so presence, polls and routers
+	// can be tested on recorded traffic.
+	Replayer struct {
+		records  []*Record
+		handlers *registry
+	}
+)
+
+// NewRecorder returns a recorder appending to the file at path, which is
+// created if needed.
+func NewRecorder(path string) (*Recorder, error) {
+	r := &Recorder{
+		Path:    path,
+		wake:    make(chan struct{}, 1),
+		stopped: make(chan struct{}),
+	}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	go r.run()
+
+	return r, nil
+}
+
+// Attach records the frames of src until the returned function is called.
+func (r *Recorder) Attach(src FrameSource) (detach func()) {
+	return src.Tap(r.tap)
+}
+
+// Write writes a record to the transcript, rotating it first if needed. The
+// record is still written if the transcript could not be renamed.
+func (r *Recorder) Write(rec *Record) error {
+	line, err := ffjson.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return os.ErrClosed
+	}
+	var rotateErr error
+	if r.expired(rec.Time, int64(len(line))) {
+		if rotateErr = r.rotate(rec.Time); r.file == nil {
+			return rotateErr
+		}
+	}
+
+	n, err := r.file.Write(line)
+	r.size += int64(n)
+	if err == nil {
+		err = rotateErr
+	}
+	return err
+}
+
+// Rotate renames the transcript and starts a new one.
+func (r *Recorder) Rotate() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return os.ErrClosed
+	}
+	return r.rotate(time.Now())
+}
+
+// Close writes the frames tapped so far and closes the transcript, frames of
+// attached sources are dropped after.
+func (r *Recorder) Close() error {
+	r.queueMu.Lock()
+	if !r.closed {
+		r.closed = true
+		close(r.wake)
+	}
+	r.queueMu.Unlock()
+	<-r.stopped
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return os.ErrClosed
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
+
+// tap queues a frame for the goroutine of the recorder.
+func (r *Recorder) tap(dir Direction, frame []byte) {
+	rec := &Record{Time: time.Now(), Direction: dir, Frame: append(json.RawMessage(nil), frame...)}
+
+	r.queueMu.Lock()
+	defer r.queueMu.Unlock()
+
+	switch {
+	case r.closed:
+		return
+	case len(r.queue) >= recorderBacklog:
+		r.dropped = true
+	default:
+		r.queue = append(r.queue, rec)
+	}
+
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run writes the queued frames until the recorder is closed.
+func (r *Recorder) run() {
+	defer close(r.stopped)
+
+	for {
+		_, open := <-r.wake
+
+		r.queueMu.Lock()
+		queue, dropped := r.queue, r.dropped
+		r.queue, r.dropped = nil, false
+		r.queueMu.Unlock()
+
+		for _, rec := range queue {
+			if err := r.Write(rec); err != nil && r.OnError != nil {
+				r.OnError(err)
+			}
+		}
+		if dropped && r.OnError != nil {
+			r.OnError(ErrRecorderBehind)
+		}
+		if !open {
+			return
+		}
+	}
+}
+
+// expired reports whether writing n more bytes at now needs a new file. An
+// empty file is never rotated.
+func (r *Recorder) expired(now time.Time, n int64) bool {
+	if r.size == 0 {
+		return false
+	}
+
+	return r.MaxSize > 0 && r.size+n > r.MaxSize ||
+		r.MaxAge > 0 && now.Sub(r.opened) >= r.MaxAge
+}
+
+func (r *Recorder) open() error {
+	file, err := os.OpenFile(r.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	r.file, r.size, r.opened = file, info.Size(), time.Now()
+	return nil
+}
+
+// rotate renames the transcript and opens a new one. The transcript is opened
+// again if it could not be renamed, so the recording goes on.
+func (r *Recorder) rotate(now time.Time) error {
+	err := r.file.Close()
+	r.file = nil
+	if err == nil {
+		err = os.Rename(r.Path, r.Path+"."+now.UTC().Format(rotatedLayout))
+	}
+	if openErr := r.open(); err == nil {
+		err = openErr
+	}
+
+	return err
+}
+
+// ReadTranscript reads the records of a transcript written by a Recorder.
+func ReadTranscript(rd io.Reader) ([]*Record, error) {
+	var records []*Record
+
+	scanner := bufio.NewScanner(rd)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		rec := new(Record)
+		if err := ffjson.Unmarshal(scanner.Bytes(), rec); err != nil {
+			return nil, err
+		}
+		records = append(records, rec)
+	}
+
+	return records, scanner.Err()
+}
+
+// NewReplayer returns a replayer of the records, see ReadTranscript.
+func NewReplayer(records []*Record) *Replayer {
+	return &Replayer{records: records, handlers: newRegistry()}
+}
+
+// Handle registers a handler for the replayed events, see Connection.Handle.
+func (p *Replayer) Handle(fn interface{}) (remove func()) {
+	return p.handlers.add(fn)
+}
+
+// Notify relays every replayed event to ch, see Connection.Notify.
+func (p *Replayer) Notify(ch chan<- interface{}) (stop func()) {
+	return p.Handle(notifier(ch))
+}
+
+// Replay passes the received events to the handlers, one by one in the
+// calling goroutine, keeping the time between them divided by speed: 1 is the
+// real speed, 2 twice as fast and 0 as fast as possible. Sent frames and
+// replies are skipped.
+func (p *Replayer) Replay(ctx context.Context, speed float64) error {
+	var last time.Time
+	for _, rec := range p.records {
+		if rec.Direction != DirectionIn {
+			continue
+		}
+
+		var evt Event
+		if err := ffjson.Unmarshal(rec.Frame, &evt); err != nil || evt.Type != typeEvent {
+			continue
+		}
+
+		if speed > 0 && !last.IsZero() {
+			if err := sleep(ctx, time.Duration(float64(rec.Time.Sub(last))/speed)); err != nil {
+				return err
+			}
+		}
+		last = rec.Time
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		data, err := DecodeEvent(&evt)
+		if err != nil {
+			data = &evt
+		}
+		p.handlers.call(evt.Event, data)
+	}
+
+	return nil
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
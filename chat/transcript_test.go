@@ -0,0 +1,184 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	ws "github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecorder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transcript")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The server sends a message before replying to the ping.
+	srv := serve(func(conn *ws.Conn) {
+		var mtd Method
+		if err := conn.ReadJSON(&mtd); err != nil {
+			return
+		}
+		conn.WriteJSON(&Event{Type: typeEvent, Event: EventChatMessage, Data: json.RawMessage(`{"id":"m1","user_name":"connor","message":{"message":[{"type":"text","text":"hi"}]}}`)})
+		conn.WriteJSON(&Reply{Type: typeReply, ID: mtd.ID})
+		conn.ReadMessage()
+	})
+	defer srv.Close()
+
+	path := filepath.Join(dir, "chat.log")
+	rec, err := NewRecorder(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec.OnError = func(err error) { t.Error(err) }
+
+	conn := dial(t, srv)
+	defer conn.Close()
+	detach := rec.Attach(conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.NoError(t, conn.Ping(ctx))
+	detach()
+	assert.NoError(t, rec.Close())
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := ReadTranscript(bytes.NewReader(data))
+	assert.NoError(t, err)
+	if assert.Len(t, records, 3) {
+		assert.Equal(t, DirectionOut, records[0].Direction)
+		assert.Contains(t, string(records[0].Frame), `"method":"ping"`)
+		assert.Equal(t, DirectionIn, records[1].Direction)
+		assert.Contains(t, string(records[1].Frame), `"event":"ChatMessage"`)
+		assert.Equal(t, DirectionIn, records[2].Direction)
+		assert.Contains(t, string(records[2].Frame), `"type":"reply"`)
+		assert.False(t, records[0].Time.IsZero())
+	}
+}
+
+func TestRecorderRotate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transcript")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "chat.log")
+	rec, err := NewRecorder(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec.MaxSize = 100
+
+	start := time.Date(2017, 1, 2, 15, 4, 5, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, rec.Write(&Record{
+			Time:      start.Add(time.Duration(i) * time.Second),
+			Direction: DirectionOut,
+			Frame:     json.RawMessage(`{"type":"method","method":"ping","arguments":null,"id":1}`),
+		}))
+	}
+	assert.NoError(t, rec.Close())
+	assert.Equal(t, os.ErrClosed, rec.Write(&Record{Frame: json.RawMessage(`{}`)}))
+
+	matches, _ := filepath.Glob(path + ".*")
+	assert.Equal(t, []string{
+		path + ".20170102T150406.000000000",
+		path + ".20170102T150407.000000000",
+	}, matches)
+
+	data, _ := ioutil.ReadFile(path)
+	records, err := ReadTranscript(bytes.NewReader(data))
+	assert.NoError(t, err)
+	if assert.Len(t, records, 1) {
+		assert.True(t, start.Add(2*time.Second).Equal(records[0].Time))
+	}
+}
+
+func TestRecorderRenameFails(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transcript")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A directory in the way of the rotated name fails the rename.
+	path := filepath.Join(dir, "chat.log")
+	taken := path + ".20170102T150406.000000000"
+	if err := os.MkdirAll(filepath.Join(taken, "full"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	rec, err := NewRecorder(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec.MaxSize = 100
+
+	start := time.Date(2017, 1, 2, 15, 4, 5, 0, time.UTC)
+	write := func(i int) error {
+		return rec.Write(&Record{
+			Time:      start.Add(time.Duration(i) * time.Second),
+			Direction: DirectionOut,
+			Frame:     json.RawMessage(`{"type":"method","method":"ping","arguments":null,"id":1}`),
+		})
+	}
+	assert.NoError(t, write(0))
+	assert.Error(t, write(1))
+	assert.NoError(t, write(2))
+	assert.NoError(t, rec.Close())
+
+	// The records kept going to the transcript until it could be renamed.
+	data, _ := ioutil.ReadFile(path + ".20170102T150407.000000000")
+	records, err := ReadTranscript(bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.Len(t, records, 2)
+}
+
+func TestReplayer(t *testing.T) {
+	start := time.Now()
+	transcript := `{"time":"` + start.Format(time.RFC3339Nano) + `","dir":"in","frame":{"type":"event","event":"UserJoin","data":{"id":1,"username":"connor"}}}
+{"time":"` + start.Add(time.Millisecond).Format(time.RFC3339Nano) + `","dir":"out","frame":{"type":"method","method":"msg","arguments":["hi"],"id":1}}
+{"time":"` + start.Add(2*time.Millisecond).Format(time.RFC3339Nano) + `","dir":"in","frame":{"type":"reply","error":null,"data":null,"id":1}}
+
+{"time":"` + start.Add(50*time.Millisecond).Format(time.RFC3339Nano) + `","dir":"in","frame":{"type":"event","event":"ChatMessage","data":{"id":"m1","user_name":"connor","message":{"message":[{"type":"text","text":"hi"}]}}}}
+`
+	records, err := ReadTranscript(bytes.NewBufferString(transcript))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, records, 4)
+
+	replay := NewReplayer(records)
+	var names []string
+	replay.Handle(func(evt *UserJoin) { names = append(names, evt.UserName) })
+	replay.Handle(func(msg *ChatMessage) { names = append(names, msg.Message.PlainText()) })
+
+	ctx := context.Background()
+	begin := time.Now()
+	assert.NoError(t, replay.Replay(ctx, 1))
+	assert.True(t, time.Since(begin) >= 50*time.Millisecond)
+	assert.Equal(t, []string{"connor", "hi"}, names)
+
+	// The delays are divided by the speed.
+	names = nil
+	begin = time.Now()
+	assert.NoError(t, replay.Replay(ctx, 0))
+	assert.True(t, time.Since(begin) < 50*time.Millisecond)
+	assert.Equal(t, []string{"connor", "hi"}, names)
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.Equal(t, context.Canceled, replay.Replay(canceled, 1))
+}
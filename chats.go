@@ -0,0 +1,32 @@
+package beam
+
+import (
+	"context"
+	"fmt"
+)
+
+// ChatsService handles communication with the chat related methods of the
+// API.
+type ChatsService service
+
+// Get returns the chat servers of a channel and the key to authenticate in its
+// chat. Anonymous clients get the servers only.
+func (s *ChatsService) Get(ctx context.Context, channelID uint) (*ChatDetails, error) {
+	var details ChatDetails
+	if err := s.client.get(ctx, fmt.Sprintf("chats/%d", channelID), &details); err != nil {
+		return nil, err
+	}
+
+	return &details, nil
+}
+
+// Users returns the users in the chat of the channel.
+func (s *ChatsService) Users(ctx context.Context, channelID uint, opts *ListOptions) ([]ChatUser, error) {
+	var users []ChatUser
+	path := withQuery(fmt.Sprintf("chats/%d/users", channelID), opts.values())
+	if err := s.client.get(ctx, path, &users); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
@@ -0,0 +1,222 @@
+package beam
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	ffjson "github.com/pquerna/ffjson/ffjson"
+)
+
+const defaultBaseURL = "https://beam.pro/api/v1/"
+
+type (
+	// Client manages communication with the REST API.
+	Client struct {
+		// HTTP client used to communicate with the API. Use an OAuth client
+		// for endpoints which require authorization.
+		HTTPClient *http.Client
+
+		// Base URL for API requests. BaseURL should always be specified with a
+		// trailing slash.
+		BaseURL *url.URL
+
+		// User agent used when communicating with the API.
+		UserAgent string
+
+		Channels   *ChannelsService
+		Chats      *ChatsService
+		Invoices   *InvoicesService
+		Recordings *RecordingsService
+		Teams      *TeamsService
+		Users      *UsersService
+	}
+
+	service struct {
+		client *Client
+	}
+
+	// ListOptions specifies the optional parameters to methods that support
+	// pagination.
+	ListOptions struct {
+		// Page of results to retrieve, starts from 0.
+		Page int
+
+		// Number of results to include per page.
+		Limit int
+	}
+
+	// ErrorResponse reports an error caused by an API request.
+	ErrorResponse struct {
+		// HTTP response that caused this error.
+		Response *http.Response
+
+		// Decoded error body, if the API sent one.
+		Body *Error
+	}
+)
+
+// NewClient returns a new API client. If a nil httpClient is provided,
+// http.DefaultClient will be used.
+func NewClient(httpClient *http.Client) *Client {
+	c, _ := NewEnvClient(DefaultEnvironment, httpClient)
+	return c
+}
+
+// NewEnvClient returns a new API client of the REST API of the environment.
+func NewEnvClient(env *Environment, httpClient *http.Client) (*Client, error) {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	baseURL, err := url.Parse(env.APIURL)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		HTTPClient: httpClient,
+		BaseURL:    baseURL,
+	}
+	common := &service{client: c}
+	c.Channels = (*ChannelsService)(common)
+	c.Chats = (*ChatsService)(common)
+	c.Invoices = (*InvoicesService)(common)
+	c.Recordings = (*RecordingsService)(common)
+	c.Teams = (*TeamsService)(common)
+	c.Users = (*UsersService)(common)
+
+	return c, nil
+}
+
+// NewRequest creates an API request. A relative URL can be provided in path,
+// in which case it is resolved relative to the BaseURL of the Client. If
+// specified, the value pointed to by body is JSON encoded and included as the
+// request body.
+func (c *Client) NewRequest(method, path string, body interface{}) (*http.Request, error) {
+	rel, err := url.Parse(path)
+	if err != nil {
+		return nil, err
+	}
+
+	u := c.BaseURL.ResolveReference(rel)
+
+	var buf io.Reader
+	if body != nil {
+		data, err := ffjson.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		buf = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, u.String(), buf)
+	if err != nil {
+		return nil, err
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
+
+	return req, nil
+}
+
+// Do sends an API request and returns the API response. The response body is
+// JSON decoded and stored in the value pointed to by v. Any non-2xx response
+// is returned as *ErrorResponse.
+func (c *Client) Do(ctx context.Context, req *http.Request, v interface{}) (*http.Response, error) {
+	resp, err := c.HTTPClient.Do(req.WithContext(ctx))
+	if err != nil {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return resp, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		errResp := &ErrorResponse{Response: resp}
+		if len(data) > 0 {
+			var body Error
+			if ffjson.Unmarshal(data, &body) == nil {
+				errResp.Body = &body
+			}
+		}
+		return resp, errResp
+	}
+
+	if v == nil || len(data) == 0 {
+		return resp, nil
+	}
+
+	return resp, ffjson.Unmarshal(data, v)
+}
+
+func (c *Client) get(ctx context.Context, path string, v interface{}) error {
+	req, err := c.NewRequest(http.MethodGet, path, nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.Do(ctx, req, v)
+	return err
+}
+
+// Error implements the error interface.
+func (r *ErrorResponse) Error() string {
+	msg := http.StatusText(r.Response.StatusCode)
+	if r.Body != nil {
+		msg = r.Body.Error
+		if r.Body.Message != "" {
+			msg += ": " + r.Body.Message
+		}
+	}
+
+	return fmt.Sprintf(
+		"%s %s: %d %s",
+		r.Response.Request.Method, r.Response.Request.URL, r.Response.StatusCode, msg,
+	)
+}
+
+// values returns the page and limit parameters as a query.
+func (opts *ListOptions) values() url.Values {
+	q := url.Values{}
+	if opts == nil {
+		return q
+	}
+
+	if opts.Page > 0 {
+		q.Set("page", strconv.Itoa(opts.Page))
+	}
+	if opts.Limit > 0 {
+		q.Set("limit", strconv.Itoa(opts.Limit))
+	}
+
+	return q
+}
+
+// withQuery appends non-empty query parameters to path.
+func withQuery(path string, q url.Values) string {
+	if len(q) == 0 {
+		return path
+	}
+
+	return path + "?" + q.Encode()
+}
@@ -0,0 +1,77 @@
+package beam
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func setup() (*Client, *http.ServeMux, func()) {
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+
+	client := NewClient(nil)
+	client.BaseURL, _ = url.Parse(srv.URL + "/api/v1/")
+
+	return client, mux, srv.Close
+}
+
+func TestChannelsGet(t *testing.T) {
+	client, mux, teardown := setup()
+	defer teardown()
+
+	mux.HandleFunc("/api/v1/channels/toby3d", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method)
+		fmt.Fprint(w, `{"id":42,"userId":7,"token":"toby3d","online":true,"viewersCurrent":9}`)
+	})
+
+	channel, err := client.Channels.Get(context.Background(), "toby3d")
+	assert.NoError(t, err)
+	assert.Equal(t, uint(42), channel.ID)
+	assert.Equal(t, uint(7), channel.UserID)
+	assert.Equal(t, "toby3d", channel.Token)
+	assert.True(t, channel.Online)
+	assert.Equal(t, uint(9), channel.ViewersCurrent)
+}
+
+func TestTeamsUsersPagination(t *testing.T) {
+	client, mux, teardown := setup()
+	defer teardown()
+
+	mux.HandleFunc("/api/v1/teams/3/users", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "2", r.URL.Query().Get("page"))
+		assert.Equal(t, "50", r.URL.Query().Get("limit"))
+		fmt.Fprint(w, `[{"id":1,"username":"connor"},{"id":2,"username":"matt"}]`)
+	})
+
+	users, err := client.Teams.Users(context.Background(), 3, &ListOptions{Page: 2, Limit: 50})
+	assert.NoError(t, err)
+	if assert.Len(t, users, 2) {
+		assert.Equal(t, "connor", users[0].UserName)
+		assert.Equal(t, uint(2), users[1].ID)
+	}
+}
+
+func TestErrorResponse(t *testing.T) {
+	client, mux, teardown := setup()
+	defer teardown()
+
+	mux.HandleFunc("/api/v1/recordings/1", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"statusCode":404,"error":"Not Found","message":"Recording not found."}`)
+	})
+
+	_, err := client.Recordings.Get(context.Background(), 1)
+	errResp, ok := err.(*ErrorResponse)
+	if assert.True(t, ok, "expected *ErrorResponse, got %T", err) {
+		assert.Equal(t, http.StatusNotFound, errResp.Response.StatusCode)
+		assert.Equal(t, "Not Found", errResp.Body.Error)
+		assert.Equal(t, 404, errResp.Body.StatusCode)
+		assert.Equal(t, "Recording not found.", errResp.Body.Message)
+	}
+}
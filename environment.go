@@ -0,0 +1,73 @@
+package beam
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Environment is the set of endpoints of a Beam deployment, shared by the REST
+// client, the oauth and the chat packages.
+type Environment struct {
+	// OAuth authorization page, token and shortcode endpoints.
+	AuthURL      string
+	TokenURL     string
+	ShortcodeURL string
+
+	// Base URL of the REST API, with a trailing slash.
+	APIURL string
+
+	// Chat server to dial when the channel does not list its own.
+	ChatURL string
+
+	// Constellation live events server.
+	ConstellationURL string
+
+	// Interactive servers discovery endpoint.
+	InteractiveURL string
+}
+
+// DefaultEnvironment is the production deployment at beam.pro.
+var DefaultEnvironment = &Environment{
+	AuthURL:          "https://beam.pro/oauth/authorize",
+	TokenURL:         "https://beam.pro/api/v1/oauth/token",
+	ShortcodeURL:     "https://beam.pro/api/v1/oauth/shortcode",
+	APIURL:           defaultBaseURL,
+	ChatURL:          "wss://chat.beam.pro",
+	ConstellationURL: "wss://constellation.beam.pro",
+	InteractiveURL:   "https://beam.pro/api/v1/interactive/hosts",
+}
+
+// HostEnvironment returns the environment of a deployment served from a
+// single host, like a staging proxy or a local test server. The REST and
+// OAuth endpoints keep their production paths and the websockets are served
+// at /chat and /constellation with the matching ws or wss scheme.
+func HostEnvironment(host string) (*Environment, error) {
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, err
+	}
+
+	var wsScheme string
+	switch u.Scheme {
+	case "http":
+		wsScheme = "ws"
+	case "https":
+		wsScheme = "wss"
+	default:
+		return nil, fmt.Errorf("beam: host %q is not an http or https URL", host)
+	}
+
+	base := u.Scheme + "://" + u.Host + strings.TrimSuffix(u.Path, "/")
+	sockets := wsScheme + "://" + u.Host + strings.TrimSuffix(u.Path, "/")
+
+	return &Environment{
+		AuthURL:          base + "/oauth/authorize",
+		TokenURL:         base + "/api/v1/oauth/token",
+		ShortcodeURL:     base + "/api/v1/oauth/shortcode",
+		APIURL:           base + "/api/v1/",
+		ChatURL:          sockets + "/chat",
+		ConstellationURL: sockets + "/constellation",
+		InteractiveURL:   base + "/api/v1/interactive/hosts",
+	}, nil
+}
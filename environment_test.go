@@ -0,0 +1,53 @@
+package beam
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHostEnvironment(t *testing.T) {
+	env, err := HostEnvironment("https://staging.example.com/")
+	assert.NoError(t, err)
+	assert.Equal(t, &Environment{
+		AuthURL:          "https://staging.example.com/oauth/authorize",
+		TokenURL:         "https://staging.example.com/api/v1/oauth/token",
+		ShortcodeURL:     "https://staging.example.com/api/v1/oauth/shortcode",
+		APIURL:           "https://staging.example.com/api/v1/",
+		ChatURL:          "wss://staging.example.com/chat",
+		ConstellationURL: "wss://staging.example.com/constellation",
+		InteractiveURL:   "https://staging.example.com/api/v1/interactive/hosts",
+	}, env)
+
+	env, err = HostEnvironment("http://127.0.0.1:8080")
+	assert.NoError(t, err)
+	assert.Equal(t, "ws://127.0.0.1:8080/chat", env.ChatURL)
+
+	_, err = HostEnvironment("ftp://example.com")
+	assert.Error(t, err)
+}
+
+func TestNewEnvClient(t *testing.T) {
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	mux.HandleFunc("/api/v1/users/7", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id":7,"username":"toby3d"}`)
+	})
+
+	env, _ := HostEnvironment(srv.URL)
+	client, err := NewEnvClient(env, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	user, err := client.Users.Get(context.Background(), 7)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(7), user.ID)
+
+	assert.Equal(t, DefaultEnvironment.APIURL, NewClient(nil).BaseURL.String())
+}
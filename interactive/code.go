@@ -2,59 +2,178 @@ package interactive
 
 import (
 	"bytes"
+	"compress/flate"
 	"compress/gzip"
+	"compress/zlib"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
+	"sort"
+	"sync"
 
+	"github.com/klauspost/compress/zstd"
 	"github.com/pierrec/lz4"
 )
 
+const defaultMaxDecodeSize = 2000000
+
+var (
+	// ErrTooLarge is the error of a message bigger than the largest size
+	// accepted by the coder.
+	ErrTooLarge = errors.New("interactive: message too large")
+
+	// ErrCorrupt is the error of a packet which can not be decoded.
+	ErrCorrupt = errors.New("interactive: corrupt packet")
+)
+
+// DecodeError is returned by a Coder for a packet which can not be decoded.
+type DecodeError struct {
+	// Err is ErrTooLarge or ErrCorrupt.
+	Err error
+
+	// Offset is the position of the bad message, counted in bytes of every
+	// packet decoded since the coder was created or reset.
+	Offset int64
+
+	// Size is the size of the message too large.
+	Size uint64
+
+	// Cause is the error of the decompressing stream, if any.
+	Cause error
+}
+
 type FlusherWriter interface {
 	io.Writer
 	Flush() error
 }
 
+// Codec makes the compressing and decompressing streams of a compression
+// scheme. The writer must flush every written byte on Flush, so the reader can
+// decode each message as soon as it arrives.
+type Codec interface {
+	// NewWriter returns a compressing writer to w. The level is codec
+	// specific, DefaultLevel asks for the codec default.
+	NewWriter(w io.Writer, level int) (FlusherWriter, error)
+
+	// NewReader returns a decompressing reader from r. It is called once the
+	// first packet is in r, as the stream may start with a header.
+	NewReader(r io.Reader) (io.Reader, error)
+}
+
+// Option configures a Coder.
+type Option func(*Coder)
+
+// DefaultLevel asks the codec for its default compression level.
+const DefaultLevel = -1
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[string]Codec{
+		"none":    noneCodec{},
+		"gzip":    gzipCodec{},
+		"lz4":     lz4Codec{},
+		"deflate": deflateCodec{},
+		"zlib":    zlibCodec{},
+		"zstd":    zstdCodec{},
+	}
+)
+
 // A Coder is responsible for encoding and decoding discreet JSON messages
 // for sending and receiving with a consumer. The Coder is allowed to be
 // stateful but it must be safe to use Encode and Decode in parallel with
 // each other, however Encode and Decode themselves may not be thread safe.
 type Coder struct {
-	initializeReader func() (io.Reader, error)
+	initializeReader func(io.Reader) (io.Reader, error)
 	varUintBuffer    [binary.MaxVarintLen64]byte
 	maxDecodeSize    uint64
+	level            int
 	rBuf             *bytes.Buffer
 	wBuf             *bytes.Buffer
-	r                io.Reader
 	w                FlusherWriter
+	raw              bool
+	offset           int64
+	ready            [][]byte
+	stream           *streamDecoder
+	sizes            []pendingSize
+
+	// The bytes left of an uncompressed message too large, dropped as they
+	// arrive.
+	skip uint64
 }
 
-// Creates a GZIP coder
-func NewGzip() *Coder {
-	wBuf := &bytes.Buffer{}
-	rBuf := &bytes.Buffer{}
+// RegisterCodec makes a compression scheme available by name, replacing the
+// codec registered before with the same name.
+func RegisterCodec(name string, codec Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	codecs[name] = codec
+}
 
-	return &Coder{
-		maxDecodeSize:    2000000,
-		initializeReader: func() (io.Reader, error) { return gzip.NewReader(rBuf) },
-		wBuf:             wBuf,
-		rBuf:             rBuf,
-		w:                gzip.NewWriter(wBuf),
+// Codecs returns the names of the registered compression schemes.
+func Codecs() []string {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+
+	names := make([]string, 0, len(codecs))
+	for name := range codecs {
+		names = append(names, name)
 	}
+	sort.Strings(names)
+
+	return names
 }
 
-// Creates an LZ4 coder
-func NewLZ4() *Coder {
-	wBuf := &bytes.Buffer{}
-	rBuf := &bytes.Buffer{}
+// WithMaxDecodeSize sets the size of the largest message Decode accepts,
+// 2,000,000 bytes by default.
+func WithMaxDecodeSize(size uint64) Option {
+	return func(c *Coder) { c.maxDecodeSize = size }
+}
 
-	return &Coder{
-		maxDecodeSize: 2000000,
-		wBuf:          wBuf,
-		rBuf:          rBuf,
-		w:             lz4.NewWriter(wBuf),
-		r:             lz4.NewReader(rBuf),
+// WithLevel sets the compression level.
+func WithLevel(level int) Option {
+	return func(c *Coder) { c.level = level }
+}
+
+// NewCoder creates a coder of the registered compression scheme.
+func NewCoder(name string, opts ...Option) (*Coder, error) {
+	codecsMu.RLock()
+	codec, ok := codecs[name]
+	codecsMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("interactive: unknown compression %q", name)
+	}
+
+	c := &Coder{
+		maxDecodeSize: defaultMaxDecodeSize,
+		level:         DefaultLevel,
+		wBuf:          &bytes.Buffer{},
+		rBuf:          &bytes.Buffer{},
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	var err error
+	if c.w, err = codec.NewWriter(c.wBuf, c.level); err != nil {
+		return nil, err
+	}
+	c.initializeReader = codec.NewReader
+	_, c.raw = codec.(noneCodec)
+
+	return c, nil
+}
+
+// Creates a GZIP coder
+func NewGzip() *Coder {
+	c, _ := NewCoder("gzip")
+	return c
+}
+
+// Creates an LZ4 coder
+func NewLZ4() *Coder {
+	c, _ := NewCoder("lz4")
+	return c
 }
 
 // Encode coverts a JSON string to a binary packet.
@@ -74,28 +193,403 @@ func (c *Coder) Encode(json []byte) (packet []byte, err error) {
 	return packet, nil
 }
 
-// Decode coverts a binary packet to a JSON string.
+// Decode coverts a binary packet to a JSON string. Packets may carry several
+// messages or a part of one, see DecodeAll: Decode returns the first message
+// completed and keeps the others for the following calls, which may pass a nil
+// packet to get them. It returns a nil message while waiting for more data.
 func (c *Coder) Decode(packet []byte) (json []byte, err error) {
-	// Look up the decompressed message size.
+	if len(packet) > 0 {
+		msgs, err := c.DecodeAll(packet)
+		c.ready = append(c.ready, msgs...)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(c.ready) == 0 {
+		return nil, nil
+	}
+
+	json = c.ready[0]
+	c.ready = c.ready[1:]
+	return json, nil
+}
+
+// DecodeAll converts a binary packet to every JSON message it completes, in
+// order. Each message is prefixed with its size.
+//
+// Without compression a packet may hold any number of messages and end in the
+// middle of one, the rest is kept until the following packets complete it.
+// A compressed packet starts with the size of one message, followed by a part
+// of the compressed stream. The stream is decompressed as it arrives, so the
+// data of a message may end in a later packet, and the messages are returned
+// once they are complete.
+//
+// On error the messages decoded are returned with a *DecodeError. A message
+// too large is skipped, even if its data ends in a later packet, and the
+// messages after it are decoded. A compressed packet whose size prefix is bad
+// is dropped and the stream goes on with the next one. If the stream itself
+// can not be decoded, the coder is reset so it can decode a new stream.
+func (c *Coder) DecodeAll(packet []byte) (msgs [][]byte, err error) {
+	if c.raw {
+		return c.decodeRaw(packet)
+	}
+
+	return c.decodeStream(packet)
+}
+
+// Reset drops the buffered data and the decompressing state, as if no packet
+// was decoded yet. Encoding is left as is.
+func (c *Coder) Reset() {
+	c.rBuf.Reset()
+	if c.stream != nil {
+		c.stream.close()
+		c.stream = nil
+	}
+	c.sizes = nil
+	c.skip = 0
+	c.offset = 0
+	c.ready = nil
+}
+
+// Close stops decompressing. The coder may still encode, and decodes a new
+// stream if more packets are passed.
+func (c *Coder) Close() {
+	c.Reset()
+}
+
+// decodeRaw splits the uncompressed stream of size prefixed messages. The
+// coder is reset if the stream is corrupt.
+func (c *Coder) decodeRaw(packet []byte) (msgs [][]byte, err error) {
+	c.rBuf.Write(packet)
+	for c.rBuf.Len() > 0 {
+		if c.skip > 0 {
+			n := c.rBuf.Len()
+			if uint64(n) > c.skip {
+				n = int(c.skip)
+			}
+			c.rBuf.Next(n)
+			c.offset += int64(n)
+			c.skip -= uint64(n)
+			continue
+		}
+
+		buf := c.rBuf.Bytes()
+		size, read := binary.Uvarint(buf)
+		if read < 0 || read == 0 && len(buf) >= binary.MaxVarintLen64 {
+			err = &DecodeError{Err: ErrCorrupt, Offset: c.offset}
+			c.Reset()
+			return msgs, err
+		}
+		if read == 0 {
+			break
+		}
+		if size > c.maxDecodeSize {
+			if err == nil {
+				err = &DecodeError{Err: ErrTooLarge, Offset: c.offset, Size: size}
+			}
+			c.rBuf.Next(read)
+			c.offset += int64(read)
+			c.skip = size
+			continue
+		}
+		if uint64(len(buf)-read) < size {
+			break
+		}
+
+		json := make([]byte, size)
+		copy(json, buf[read:])
+		c.rBuf.Next(read + int(size))
+		c.offset += int64(read) + int64(size)
+		msgs = append(msgs, json)
+	}
+
+	return msgs, err
+}
+
+// decodeStream feeds a compressed packet to the decompressing stream and
+// returns the messages it completes.
+func (c *Coder) decodeStream(packet []byte) (msgs [][]byte, err error) {
+	offset := c.offset
+	c.offset += int64(len(packet))
+
+	// Look up the decompressed message size. A packet without a valid size
+	// is not part of the stream, so it is dropped and the stream goes on.
 	size, read := binary.Uvarint(packet)
 	if read <= 0 {
-		return nil, errors.New("ref/code: error reading packet size")
+		return nil, &DecodeError{Err: ErrCorrupt, Offset: offset}
 	}
+
+	// The data of a message too large is still decompressed to keep the
+	// stream going, and dropped.
+	var tooLarge error
 	if size > c.maxDecodeSize {
-		return nil, errors.New("ref/code: packet too large, refusing to decode")
-	}
-	// Push the packet into the reader's input
-	c.rBuf.Write(packet[read:])
-	// Initialize the reader. We can't do this until we get the start of the
-	// data stream since it may want the headers when it's initialized.
-	if c.r == nil {
-		if c.r, err = c.initializeReader(); err != nil {
-			return nil, err
+		tooLarge = &DecodeError{Err: ErrTooLarge, Offset: offset, Size: size}
+	}
+	c.sizes = append(c.sizes, pendingSize{size: size, skip: tooLarge != nil})
+
+	// Start the stream on its first data, as the reader may want the
+	// headers when it is initialized.
+	if c.stream == nil {
+		c.stream = newStreamDecoder(c.initializeReader)
+	}
+	out, err := c.stream.feed(packet[read:])
+	msgs = c.split(out)
+	if err != nil {
+		c.Reset()
+		c.offset = offset + int64(len(packet))
+		return msgs, &DecodeError{Err: ErrCorrupt, Offset: offset, Cause: err}
+	}
+
+	return msgs, tooLarge
+}
+
+// split cuts the decompressed data into the pending messages.
+func (c *Coder) split(out *bytes.Buffer) (msgs [][]byte) {
+	for len(c.sizes) > 0 {
+		next := &c.sizes[0]
+		if next.skip {
+			n := out.Len()
+			if uint64(n) > next.size {
+				n = int(next.size)
+			}
+			out.Next(n)
+			if next.size -= uint64(n); next.size > 0 {
+				break
+			}
+			c.sizes = c.sizes[1:]
+			continue
+		}
+		if uint64(out.Len()) < next.size {
+			break
+		}
+
+		json := make([]byte, next.size)
+		copy(json, out.Next(int(next.size)))
+		c.sizes = c.sizes[1:]
+		msgs = append(msgs, json)
+	}
+
+	return msgs
+}
+
+type (
+	// pendingSize is the size of a message announced by a compressed packet
+	// whose data was not all decompressed yet.
+	pendingSize struct {
+		size uint64
+		skip bool
+	}
+
+	// streamDecoder runs a decompressing reader in its own goroutine, so the
+	// reader can wait for the next packet at the end of the input instead of
+	// failing. Every reader returns its output before asking for input it
+	// does not have, as the writers flush each message.
+	streamDecoder struct {
+		mu   sync.Mutex
+		cond *sync.Cond
+		in   bytes.Buffer
+		out  bytes.Buffer
+
+		// waiting is set while the reader waits for input.
+		waiting bool
+		closed  bool
+		err     error
+	}
+)
+
+func newStreamDecoder(newReader func(io.Reader) (io.Reader, error)) *streamDecoder {
+	d := new(streamDecoder)
+	d.cond = sync.NewCond(&d.mu)
+	go d.run(newReader)
+
+	return d
+}
+
+// feed passes input to the reader, waits for the reader to use all of it and
+// returns the output so far. The caller takes the output it needs from it.
+func (d *streamDecoder) feed(input []byte) (*bytes.Buffer, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if len(input) > 0 {
+		d.in.Write(input)
+		d.waiting = false
+		d.cond.Broadcast()
+	}
+	for !d.waiting && d.err == nil {
+		d.cond.Wait()
+	}
+
+	return &d.out, d.err
+}
+
+func (d *streamDecoder) close() {
+	d.mu.Lock()
+	d.closed = true
+	d.cond.Broadcast()
+	d.mu.Unlock()
+}
+
+func (d *streamDecoder) run(newReader func(io.Reader) (io.Reader, error)) {
+	r, err := newReader(d)
+	if err == nil {
+		buf := make([]byte, 32*1024)
+		for err == nil {
+			var n int
+			n, err = r.Read(buf)
+
+			d.mu.Lock()
+			d.out.Write(buf[:n])
+			d.mu.Unlock()
 		}
 	}
-	json = make([]byte, size)
-	if _, err := io.ReadFull(c.r, json); err != nil {
+
+	d.mu.Lock()
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	d.err = err
+	d.cond.Broadcast()
+	d.mu.Unlock()
+}
+
+// Read gives the input to the decompressing reader, waiting for more while
+// there is none.
+func (d *streamDecoder) Read(p []byte) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for d.in.Len() == 0 && !d.closed {
+		d.waiting = true
+		d.cond.Broadcast()
+		d.cond.Wait()
+	}
+	if d.closed {
+		return 0, io.EOF
+	}
+
+	return d.in.Read(p)
+}
+
+// Unwrap returns ErrTooLarge or ErrCorrupt.
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// Error implements the error interface.
+func (e *DecodeError) Error() string {
+	msg := fmt.Sprintf("%s at offset %d", e.Err, e.Offset)
+	if e.Err == ErrTooLarge {
+		msg += fmt.Sprintf(" (%d bytes)", e.Size)
+	}
+	if e.Cause != nil {
+		msg += ": " + e.Cause.Error()
+	}
+
+	return msg
+}
+
+type (
+	noneCodec    struct{}
+	gzipCodec    struct{}
+	lz4Codec     struct{}
+	deflateCodec struct{}
+	zlibCodec    struct{}
+	zstdCodec    struct{}
+
+	// nopFlusher passes writes through as is.
+	nopFlusher struct {
+		io.Writer
+	}
+)
+
+func (noneCodec) NewWriter(w io.Writer, level int) (FlusherWriter, error) {
+	return nopFlusher{w}, nil
+}
+
+func (noneCodec) NewReader(r io.Reader) (io.Reader, error) {
+	return r, nil
+}
+
+func (gzipCodec) NewWriter(w io.Writer, level int) (FlusherWriter, error) {
+	return gzip.NewWriterLevel(w, level)
+}
+
+func (gzipCodec) NewReader(r io.Reader) (io.Reader, error) {
+	return gzip.NewReader(r)
+}
+
+func (lz4Codec) NewWriter(w io.Writer, level int) (FlusherWriter, error) {
+	return lz4.NewWriter(w), nil
+}
+
+func (lz4Codec) NewReader(r io.Reader) (io.Reader, error) {
+	return lz4.NewReader(r), nil
+}
+
+func (deflateCodec) NewWriter(w io.Writer, level int) (FlusherWriter, error) {
+	return flate.NewWriter(w, level)
+}
+
+func (deflateCodec) NewReader(r io.Reader) (io.Reader, error) {
+	return flate.NewReader(r), nil
+}
+
+func (zlibCodec) NewWriter(w io.Writer, level int) (FlusherWriter, error) {
+	return zlib.NewWriterLevel(w, level)
+}
+
+func (zlibCodec) NewReader(r io.Reader) (io.Reader, error) {
+	return zlib.NewReader(r)
+}
+
+func (zstdCodec) NewWriter(w io.Writer, level int) (FlusherWriter, error) {
+	opts := []zstd.EOption{zstd.WithEncoderConcurrency(1)}
+	if level != DefaultLevel {
+		opts = append(opts, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+	}
+
+	enc, err := zstd.NewWriter(nil, opts...)
+	if err != nil {
 		return nil, err
 	}
-	return json, nil
+
+	return &zstdWriter{enc: enc, w: w}, nil
+}
+
+func (zstdCodec) NewReader(r io.Reader) (io.Reader, error) {
+	// Without concurrency the frames are decoded as they are read, so
+	// the data of a frame is returned before the next one arrives.
+	dec, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+
+	return dec, nil
+}
+
+func (nopFlusher) Flush() error {
+	return nil
+}
+
+// zstdWriter writes a whole zstd frame on every Flush, as the zstd stream
+// decoder can not return the data of a frame until it ends.
+type zstdWriter struct {
+	enc *zstd.Encoder
+	w   io.Writer
+	buf bytes.Buffer
+}
+
+func (z *zstdWriter) Write(p []byte) (int, error) {
+	return z.buf.Write(p)
+}
+
+func (z *zstdWriter) Flush() error {
+	if z.buf.Len() == 0 {
+		return nil
+	}
+
+	_, err := z.w.Write(z.enc.EncodeAll(z.buf.Bytes(), nil))
+	z.buf.Reset()
+	return err
 }
@@ -33,3 +33,153 @@ func TestLZ4RT(t *testing.T) {
 		assert.Equal(t, x, out)
 	}
 }
+
+func TestCodecsRT(t *testing.T) {
+	for _, name := range Codecs() {
+		code, err := NewCoder(name, WithLevel(DefaultLevel))
+		if !assert.NoError(t, err, name) {
+			continue
+		}
+		peer, _ := NewCoder(name)
+		for _, x := range data {
+			in, err := code.Encode(x)
+			assert.NoError(t, err, name)
+			out, err := peer.Decode(append([]byte(nil), in...))
+			assert.NoError(t, err, name)
+			assert.Equal(t, x, out, name)
+		}
+	}
+}
+
+func TestCoderOptions(t *testing.T) {
+	code, err := NewCoder("zlib", WithLevel(9), WithMaxDecodeSize(16))
+	assert.NoError(t, err)
+
+	in, err := code.Encode(data[0])
+	assert.NoError(t, err)
+	_, err = code.Decode(in)
+	assert.Error(t, err)
+
+	_, err = NewCoder("brotli")
+	assert.Error(t, err)
+}
+
+func TestDecodeAll(t *testing.T) {
+	code, _ := NewCoder("none")
+	var stream []byte
+	for _, x := range data {
+		in, err := code.Encode(x)
+		assert.NoError(t, err)
+		stream = append(stream, in...)
+	}
+
+	// Every split of the stream in two packets yields every message once.
+	for i := 0; i <= len(stream); i += 7 {
+		peer, _ := NewCoder("none")
+		first, err := peer.DecodeAll(append([]byte(nil), stream[:i]...))
+		assert.NoError(t, err)
+		rest, err := peer.DecodeAll(append([]byte(nil), stream[i:]...))
+		assert.NoError(t, err)
+		assert.Equal(t, data, append(first, rest...), "split at %d", i)
+	}
+
+	// Decode keeps the messages after the first for the following calls.
+	peer, _ := NewCoder("none")
+	for i, x := range data {
+		packet := stream
+		if i > 0 {
+			packet = nil
+		}
+		out, err := peer.Decode(packet)
+		assert.NoError(t, err)
+		assert.Equal(t, x, out)
+	}
+	out, err := peer.Decode(nil)
+	assert.NoError(t, err)
+	assert.Nil(t, out)
+}
+
+func TestDecodeErrors(t *testing.T) {
+	code, _ := NewCoder("none", WithMaxDecodeSize(100))
+	in, _ := code.Encode(data[0])
+	in = append([]byte(nil), in...)
+	big, _ := code.Encode(data[3])
+
+	msgs, err := code.DecodeAll(append(append([]byte(nil), in...), big...))
+	assert.Equal(t, [][]byte{data[0]}, msgs)
+	if derr, ok := err.(*DecodeError); assert.True(t, ok, "%v", err) {
+		assert.Equal(t, ErrTooLarge, derr.Err)
+		assert.Equal(t, int64(len(in)), derr.Offset)
+		assert.Equal(t, uint64(len(data[3])), derr.Size)
+	}
+
+	msgs, err = code.DecodeAll([]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+	assert.Empty(t, msgs)
+	if derr, ok := err.(*DecodeError); assert.True(t, ok, "%v", err) {
+		assert.Equal(t, ErrCorrupt, derr.Unwrap())
+		assert.Equal(t, int64(len(in)+len(big)), derr.Offset)
+	}
+
+	// The coder is reset after an error and decodes the following packets.
+	msgs, err = code.DecodeAll(in)
+	assert.NoError(t, err)
+	assert.Equal(t, [][]byte{data[0]}, msgs)
+
+	// A message too large is skipped across packets.
+	half := len(big) / 2
+	msgs, err = code.DecodeAll(append([]byte(nil), big[:half]...))
+	assert.Empty(t, msgs)
+	if derr, ok := err.(*DecodeError); assert.True(t, ok, "%v", err) {
+		assert.Equal(t, ErrTooLarge, derr.Unwrap())
+	}
+	msgs, err = code.DecodeAll(append(append([]byte(nil), big[half:]...), in...))
+	assert.NoError(t, err)
+	assert.Equal(t, [][]byte{data[0]}, msgs)
+
+	gzip := NewGzip()
+	_, err = gzip.Decode([]byte{0x05, 'n', 'o', 't', ' ', 'a', ' ', 'g', 'z', 'i', 'p', ' ', 'h', 'e', 'a', 'd', 'e', 'r'})
+	if derr, ok := err.(*DecodeError); assert.True(t, ok, "%v", err) {
+		assert.Equal(t, ErrCorrupt, derr.Err)
+		assert.Error(t, derr.Cause)
+	}
+	in, _ = NewGzip().Encode(data[1])
+	out, err := gzip.Decode(in)
+	assert.NoError(t, err)
+	assert.Equal(t, data[1], out)
+}
+
+func TestDecodeStream(t *testing.T) {
+	for _, name := range Codecs() {
+		if name == "none" {
+			continue
+		}
+		code, _ := NewCoder(name)
+		peer, _ := NewCoder(name)
+
+		// The compressed data of a message is split over two packets, the
+		// second one starting with the size of the next message.
+		first, _ := code.Encode(data[0])
+		first = append([]byte(nil), first...)
+		second, _ := code.Encode(data[1])
+		half := len(first) / 2
+
+		msgs, err := peer.DecodeAll(append([]byte(nil), first[:half]...))
+		assert.NoError(t, err, name)
+		rest := append(append([]byte(nil), second[:1]...), first[half:]...)
+		rest = append(rest, second[1:]...)
+		more, err := peer.DecodeAll(rest)
+		assert.NoError(t, err, name)
+		assert.Equal(t, data[:2], append(msgs, more...), name)
+
+		// A bad size drops the packet, and the stream goes on.
+		msgs, err = peer.DecodeAll([]byte{0x80, 0x80})
+		assert.Empty(t, msgs, name)
+		assert.IsType(t, &DecodeError{}, err, name)
+		in, _ := code.Encode(data[2])
+		out, err := peer.Decode(in)
+		assert.NoError(t, err, name)
+		assert.Equal(t, data[2], out, name)
+
+		peer.Close()
+	}
+}
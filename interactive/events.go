@@ -0,0 +1,296 @@
+package interactive
+
+import (
+	"fmt"
+
+	ffjson "github.com/pquerna/ffjson/ffjson"
+)
+
+// Names of the methods called by the server.
+const (
+	EventHello             = "hello"
+	EventReady             = "onReady"
+	EventParticipantJoin   = "onParticipantJoin"
+	EventParticipantLeave  = "onParticipantLeave"
+	EventParticipantUpdate = "onParticipantUpdate"
+	EventGiveInput         = "giveInput"
+	EventSceneCreate       = "onSceneCreate"
+	EventSceneUpdate       = "onSceneUpdate"
+	EventSceneDelete       = "onSceneDelete"
+	EventControlCreate     = "onControlCreate"
+	EventControlUpdate     = "onControlUpdate"
+	EventControlDelete     = "onControlDelete"
+	EventGroupCreate       = "onGroupCreate"
+	EventGroupUpdate       = "onGroupUpdate"
+	EventGroupDelete       = "onGroupDelete"
+)
+
+type (
+	// Hello is sent after connecting.
+	Hello struct{}
+
+	// ReadyChange is sent when the game becomes ready or stops being ready.
+	ReadyChange struct {
+		IsReady bool `json:"isReady"`
+	}
+
+	// ParticipantJoin is sent when participants connect.
+	ParticipantJoin struct {
+		Participants []Participant `json:"participants"`
+	}
+
+	// ParticipantLeave is sent when participants disconnect.
+	ParticipantLeave struct {
+		Participants []Participant `json:"participants"`
+	}
+
+	// ParticipantUpdate is sent when participants change.
+	ParticipantUpdate struct {
+		Participants []Participant `json:"participants"`
+	}
+
+	// GiveInput is sent when a participant interacts with a control.
+	GiveInput struct {
+		// The session ID of the participant.
+		ParticipantID string `json:"participantID"`
+
+		// The transaction to capture, set for controls which cost sparks.
+		TransactionID string `json:"transactionID,omitempty"`
+
+		Input Input `json:"input"`
+	}
+
+	// SceneCreate is sent when scenes are created.
+	SceneCreate struct {
+		Scenes []Scene `json:"scenes"`
+	}
+
+	// SceneUpdate is sent when scenes change.
+	SceneUpdate struct {
+		Scenes []Scene `json:"scenes"`
+	}
+
+	// SceneDelete is sent when a scene is deleted, its groups are moved to the
+	// reassign scene.
+	SceneDelete struct {
+		SceneID         string `json:"sceneID"`
+		ReassignSceneID string `json:"reassignSceneID"`
+	}
+
+	// ControlCreate is sent when controls are added to a scene.
+	ControlCreate struct {
+		SceneID  string    `json:"sceneID"`
+		Controls []Control `json:"controls"`
+	}
+
+	// ControlUpdate is sent when controls of a scene change.
+	ControlUpdate struct {
+		SceneID  string    `json:"sceneID"`
+		Controls []Control `json:"controls"`
+	}
+
+	// ControlDelete is sent when controls are removed from a scene.
+	ControlDelete struct {
+		SceneID  string    `json:"sceneID"`
+		Controls []Control `json:"controls"`
+	}
+
+	// GroupCreate is sent when groups are created.
+	GroupCreate struct {
+		Groups []Group `json:"groups"`
+	}
+
+	// GroupUpdate is sent when groups change.
+	GroupUpdate struct {
+		Groups []Group `json:"groups"`
+	}
+
+	// GroupDelete is sent when a group is deleted, its participants are moved
+	// to the reassign group.
+	GroupDelete struct {
+		GroupID         string `json:"groupID"`
+		ReassignGroupID string `json:"reassignGroupID"`
+	}
+
+	handler struct {
+		fn func(interface{})
+	}
+)
+
+// DecodeEvent returns the typed params of a known method called by the
+// server, like *ParticipantJoin or *GiveInput. Unknown methods are returned
+// as is.
+func DecodeEvent(mtd *Method) (interface{}, error) {
+	var data interface{}
+	switch mtd.Method {
+	case EventHello:
+		data = new(Hello)
+	case EventReady:
+		data = new(ReadyChange)
+	case EventParticipantJoin:
+		data = new(ParticipantJoin)
+	case EventParticipantLeave:
+		data = new(ParticipantLeave)
+	case EventParticipantUpdate:
+		data = new(ParticipantUpdate)
+	case EventGiveInput:
+		data = new(GiveInput)
+	case EventSceneCreate:
+		data = new(SceneCreate)
+	case EventSceneUpdate:
+		data = new(SceneUpdate)
+	case EventSceneDelete:
+		data = new(SceneDelete)
+	case EventControlCreate:
+		data = new(ControlCreate)
+	case EventControlUpdate:
+		data = new(ControlUpdate)
+	case EventControlDelete:
+		data = new(ControlDelete)
+	case EventGroupCreate:
+		data = new(GroupCreate)
+	case EventGroupUpdate:
+		data = new(GroupUpdate)
+	case EventGroupDelete:
+		data = new(GroupDelete)
+	default:
+		return mtd, nil
+	}
+
+	if len(mtd.Params) == 0 {
+		return data, nil
+	}
+
+	return data, ffjson.Unmarshal(mtd.Params, data)
+}
+
+// Handle registers a handler for methods called by the server and returns a
+// function which removes it. The handler must be one of func(*Hello),
+// func(*ReadyChange), func(*ParticipantJoin), func(*ParticipantLeave),
+// func(*ParticipantUpdate), func(*GiveInput), func(*SceneCreate),
+// func(*SceneUpdate), func(*SceneDelete), func(*ControlCreate),
+// func(*ControlUpdate), func(*ControlDelete), func(*GroupCreate),
+// func(*GroupUpdate), func(*GroupDelete) or func(interface{}) to receive every
+// event.
+//
+// Handlers are called one by one in a separate goroutine in the order the
+// events arrived, so they may use the connection to call methods.
+func (c *Connection) Handle(fn interface{}) (remove func()) {
+	name, h := newHandler(fn)
+
+	c.mu.Lock()
+	c.handlers[name] = append(c.handlers[name], h)
+	c.mu.Unlock()
+
+	return func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		list := c.handlers[name]
+		for i := range list {
+			if list[i] == h {
+				c.handlers[name] = append(list[:i:i], list[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+func newHandler(fn interface{}) (string, *handler) {
+	switch fn := fn.(type) {
+	case func(interface{}):
+		return "", &handler{fn: fn}
+	case func(*Hello):
+		return EventHello, &handler{fn: func(v interface{}) { fn(v.(*Hello)) }}
+	case func(*ReadyChange):
+		return EventReady, &handler{fn: func(v interface{}) { fn(v.(*ReadyChange)) }}
+	case func(*ParticipantJoin):
+		return EventParticipantJoin, &handler{fn: func(v interface{}) { fn(v.(*ParticipantJoin)) }}
+	case func(*ParticipantLeave):
+		return EventParticipantLeave, &handler{fn: func(v interface{}) { fn(v.(*ParticipantLeave)) }}
+	case func(*ParticipantUpdate):
+		return EventParticipantUpdate, &handler{fn: func(v interface{}) { fn(v.(*ParticipantUpdate)) }}
+	case func(*GiveInput):
+		return EventGiveInput, &handler{fn: func(v interface{}) { fn(v.(*GiveInput)) }}
+	case func(*SceneCreate):
+		return EventSceneCreate, &handler{fn: func(v interface{}) { fn(v.(*SceneCreate)) }}
+	case func(*SceneUpdate):
+		return EventSceneUpdate, &handler{fn: func(v interface{}) { fn(v.(*SceneUpdate)) }}
+	case func(*SceneDelete):
+		return EventSceneDelete, &handler{fn: func(v interface{}) { fn(v.(*SceneDelete)) }}
+	case func(*ControlCreate):
+		return EventControlCreate, &handler{fn: func(v interface{}) { fn(v.(*ControlCreate)) }}
+	case func(*ControlUpdate):
+		return EventControlUpdate, &handler{fn: func(v interface{}) { fn(v.(*ControlUpdate)) }}
+	case func(*ControlDelete):
+		return EventControlDelete, &handler{fn: func(v interface{}) { fn(v.(*ControlDelete)) }}
+	case func(*GroupCreate):
+		return EventGroupCreate, &handler{fn: func(v interface{}) { fn(v.(*GroupCreate)) }}
+	case func(*GroupUpdate):
+		return EventGroupUpdate, &handler{fn: func(v interface{}) { fn(v.(*GroupUpdate)) }}
+	case func(*GroupDelete):
+		return EventGroupDelete, &handler{fn: func(v interface{}) { fn(v.(*GroupDelete)) }}
+	}
+
+	panic(fmt.Sprintf("interactive: unsupported handler type %T", fn))
+}
+
+// enqueue adds a method called by the server to the queue of the event loop.
+func (c *Connection) enqueue(mtd *Method) {
+	c.queueMu.Lock()
+	c.queue = append(c.queue, mtd)
+	c.queueMu.Unlock()
+
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+// eventLoop calls the handlers of queued events until the socket is closed and
+// the queue is drained.
+func (c *Connection) eventLoop() {
+	for {
+		c.queueMu.Lock()
+		batch := c.queue
+		c.queue = nil
+		c.queueMu.Unlock()
+
+		for _, mtd := range batch {
+			c.handle(mtd)
+		}
+		if len(batch) > 0 {
+			continue
+		}
+
+		select {
+		case <-c.wake:
+		case <-c.done:
+			c.queueMu.Lock()
+			empty := len(c.queue) == 0
+			c.queueMu.Unlock()
+			if empty {
+				return
+			}
+		}
+	}
+}
+
+func (c *Connection) handle(mtd *Method) {
+	data, err := DecodeEvent(mtd)
+	if err != nil {
+		data = mtd
+	}
+
+	c.mu.Lock()
+	var list []*handler
+	if _, raw := data.(*Method); !raw {
+		list = append(list, c.handlers[mtd.Method]...)
+	}
+	list = append(list, c.handlers[""]...)
+	c.mu.Unlock()
+
+	for _, h := range list {
+		h.fn(data)
+	}
+}
@@ -1 +1,368 @@
 package interactive
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+
+	ws "github.com/gorilla/websocket"
+	ffjson "github.com/pquerna/ffjson/ffjson"
+	beam "gitlab.com/toby3d/mixer"
+)
+
+const (
+	typeMethod = "method"
+	typeReply  = "reply"
+
+	protocolVersion = "2.0"
+)
+
+// ErrClosed is returned by calls made on a connection whose socket is closed.
+var ErrClosed = errors.New("interactive: connection closed")
+
+type (
+	// Method is a packet which calls a method on the other side.
+	Method struct {
+		Type    string          `json:"type"`
+		ID      uint            `json:"id"`
+		Method  string          `json:"method"`
+		Params  json.RawMessage `json:"params"`
+		Discard bool            `json:"discard,omitempty"`
+	}
+
+	// Reply is a packet which answers a method with the same ID.
+	Reply struct {
+		Type   string          `json:"type"`
+		ID     uint            `json:"id"`
+		Result json.RawMessage `json:"result"`
+		Error  *ReplyError     `json:"error"`
+	}
+
+	// ReplyError is returned by a call when the server replied with an error.
+	ReplyError struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Path    string `json:"path,omitempty"`
+	}
+
+	// Connection is a game client socket. Methods are safe for concurrent use,
+	// incoming methods are passed to the registered handlers.
+	Connection struct {
+		conn      *ws.Conn
+		coderOpts []Option
+
+		writeMu sync.Mutex
+
+		mu       sync.Mutex
+		lastID   uint
+		pending  map[uint]*pending
+		handlers map[string][]*handler
+		coder    *Coder
+		err      error
+		done     chan struct{}
+
+		queueMu sync.Mutex
+		queue   []*Method
+		wake    chan struct{}
+	}
+
+	// pending is a call waiting for its reply. The hook, if any, is run by the
+	// read loop before any following packet is read.
+	pending struct {
+		reply chan *Reply
+		hook  func(*Reply)
+	}
+)
+
+// Connect dials the interactive server of the connection info as a game
+// client. The OAuth token is used for authorization, or the connection key if
+// the token is empty.
+func Connect(ctx context.Context, info *beam.InteractiveConnectionInfo, token string, opts ...Option) (*Connection, error) {
+	if token == "" {
+		token = info.Key
+	}
+
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+token)
+	header.Set("X-Protocol-Version", protocolVersion)
+	if info.Version.InteractiveVersion != nil {
+		header.Set("X-Interactive-Version", strconv.FormatUint(uint64(info.Version.ID), 10))
+	}
+
+	dial, _, err := ws.DefaultDialer.DialContext(ctx, info.Address, header)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewConnection(dial, opts...), nil
+}
+
+// NewConnection wraps an established websocket and starts reading from it.
+// The options configure the coder set up by SetCompression.
+func NewConnection(conn *ws.Conn, opts ...Option) *Connection {
+	c := &Connection{
+		conn:      conn,
+		pending:   make(map[uint]*pending),
+		handlers:  make(map[string][]*handler),
+		done:      make(chan struct{}),
+		wake:      make(chan struct{}, 1),
+		coderOpts: opts,
+	}
+	go c.readLoop()
+	go c.eventLoop()
+
+	return c
+}
+
+// Close closes the socket.
+func (c *Connection) Close() error {
+	return c.conn.Close()
+}
+
+// Done returns a channel which is closed once the socket stops reading.
+func (c *Connection) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns the error which stopped the socket, if any.
+func (c *Connection) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Call sends a method with an unique ID and waits for its reply. If result is
+// not nil, the reply result is decoded into it.
+func (c *Connection) Call(ctx context.Context, method string, params, result interface{}) error {
+	return c.call(ctx, method, params, result, nil)
+}
+
+func (c *Connection) call(ctx context.Context, method string, params, result interface{}, hook func(*Reply)) error {
+	data, err := ffjson.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	if c.err != nil {
+		err := c.err
+		c.mu.Unlock()
+		return err
+	}
+	c.lastID++
+	id := c.lastID
+	wait := &pending{reply: make(chan *Reply, 1), hook: hook}
+	c.pending[id] = wait
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	if err := c.write(&Method{
+		Type:   typeMethod,
+		ID:     id,
+		Method: method,
+		Params: data,
+	}); err != nil {
+		return err
+	}
+
+	select {
+	case rpl := <-wait.reply:
+		if rpl.Error != nil {
+			return rpl.Error
+		}
+		if result == nil || len(rpl.Result) == 0 {
+			return nil
+		}
+		return ffjson.Unmarshal(rpl.Result, result)
+	case <-c.done:
+		return c.Err()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// SetCompression asks the server to compress the following packets with the
+// first supported of the schemes, "none" turns compression off. It returns the
+// scheme chosen by the server. Every scheme must be registered, see Codecs.
+func (c *Connection) SetCompression(ctx context.Context, schemes ...string) (string, error) {
+	var result struct {
+		Scheme string `json:"scheme"`
+	}
+
+	// The server compresses every packet after the reply, so the coder must
+	// be switched before the read loop gets to them.
+	var coderErr error
+	hook := func(rpl *Reply) {
+		if rpl.Error != nil || ffjson.Unmarshal(rpl.Result, &result) != nil {
+			return
+		}
+
+		var coder *Coder
+		if result.Scheme != "none" {
+			coder, coderErr = NewCoder(result.Scheme, c.coderOpts...)
+		}
+
+		c.mu.Lock()
+		old := c.coder
+		c.coder = coder
+		c.mu.Unlock()
+
+		// The hook runs on the read loop, so the old coder is done decoding.
+		if old != nil {
+			old.Close()
+		}
+	}
+
+	params := struct {
+		Scheme []string `json:"scheme"`
+	}{schemes}
+	if err := c.call(ctx, "setCompression", params, nil, hook); err != nil {
+		return "", err
+	}
+
+	return result.Scheme, coderErr
+}
+
+func (c *Connection) write(packet interface{}) error {
+	data, err := ffjson.Marshal(packet)
+	if err != nil {
+		return err
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	c.mu.Lock()
+	coder := c.coder
+	c.mu.Unlock()
+
+	if coder == nil {
+		return c.conn.WriteMessage(ws.TextMessage, data)
+	}
+
+	if data, err = coder.Encode(data); err != nil {
+		return err
+	}
+
+	return c.conn.WriteMessage(ws.BinaryMessage, data)
+}
+
+func (c *Connection) readLoop() {
+	var (
+		err     error
+		corrupt bool
+	)
+	for {
+		var (
+			kind int
+			data []byte
+		)
+		if kind, data, err = c.conn.ReadMessage(); err != nil {
+			break
+		}
+
+		if kind != ws.BinaryMessage {
+			c.dispatch(data)
+			continue
+		}
+
+		c.mu.Lock()
+		coder := c.coder
+		c.mu.Unlock()
+
+		if coder == nil {
+			err = errors.New("interactive: compressed packet without compression")
+			break
+		}
+
+		var msgs [][]byte
+		msgs, err = coder.DecodeAll(data)
+		for _, msg := range msgs {
+			c.dispatch(msg)
+		}
+		// A bad packet is dropped and reading goes on with the stream of the
+		// peer, or with a new one if the coder had to reset. A stream which
+		// stays broken stops the socket.
+		if _, ok := err.(*DecodeError); ok && !corrupt {
+			corrupt = true
+			continue
+		}
+		if err != nil {
+			break
+		}
+		corrupt = false
+	}
+
+	c.mu.Lock()
+	if c.coder != nil {
+		c.coder.Close()
+	}
+	if c.err == nil {
+		c.err = ErrClosed
+		if !ws.IsCloseError(err, ws.CloseNormalClosure) {
+			c.err = err
+		}
+	}
+	c.mu.Unlock()
+	close(c.done)
+	c.conn.Close()
+}
+
+// dispatch routes an incoming packet. Packets which can not be decoded are
+// dropped.
+func (c *Connection) dispatch(data []byte) {
+	var head struct {
+		Type string `json:"type"`
+	}
+	if err := ffjson.Unmarshal(data, &head); err != nil {
+		return
+	}
+
+	switch head.Type {
+	case typeReply:
+		var rpl Reply
+		if err := ffjson.Unmarshal(data, &rpl); err != nil {
+			return
+		}
+
+		c.mu.Lock()
+		wait, ok := c.pending[rpl.ID]
+		c.mu.Unlock()
+		if !ok {
+			return
+		}
+
+		if wait.hook != nil {
+			wait.hook(&rpl)
+		}
+		select {
+		case wait.reply <- &rpl:
+		default:
+		}
+	case typeMethod:
+		var mtd Method
+		if err := ffjson.Unmarshal(data, &mtd); err != nil {
+			return
+		}
+
+		c.enqueue(&mtd)
+	}
+}
+
+// Error implements the error interface.
+func (e *ReplyError) Error() string {
+	if e.Path != "" {
+		return fmt.Sprintf("interactive: %d %s (%s)", e.Code, e.Message, e.Path)
+	}
+
+	return fmt.Sprintf("interactive: %d %s", e.Code, e.Message)
+}
@@ -0,0 +1,140 @@
+package interactive
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	ws "github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+// gameServer negotiates gzip, sends a participant and an input, then answers
+// getScenes.
+func gameServer(t *testing.T) *httptest.Server {
+	upgrader := ws.Upgrader{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		assert.Equal(t, "2.0", r.Header.Get("X-Protocol-Version"))
+
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		var mtd Method
+		if err := conn.ReadJSON(&mtd); err != nil {
+			return
+		}
+		assert.Equal(t, "setCompression", mtd.Method)
+		assert.JSONEq(t, `{"scheme":["gzip","none"]}`, string(mtd.Params))
+		conn.WriteJSON(&Reply{Type: typeReply, ID: mtd.ID, Result: json.RawMessage(`{"scheme":"gzip"}`)})
+
+		coder := NewGzip()
+		send := func(packet string) {
+			data, err := coder.Encode([]byte(packet))
+			assert.NoError(t, err)
+			conn.WriteMessage(ws.BinaryMessage, data)
+		}
+
+		// A corrupt packet is dropped and the stream goes on after it.
+		send(`{"type":"method","id":0,"method":"onParticipantJoin","discard":true,"params":{"participants":[{"sessionID":"s1","userID":146,"username":"connor","groupID":"default"}]}}`)
+		conn.WriteMessage(ws.BinaryMessage, []byte{0x80, 0x80, 0x80})
+		send(`{"type":"method","id":1,"method":"giveInput","discard":true,"params":{"participantID":"s1","transactionID":"t1","input":{"controlID":"jump","event":"mousedown","button":0}}}`)
+
+		kind, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		assert.Equal(t, ws.BinaryMessage, kind)
+		data, err = coder.Decode(data)
+		assert.NoError(t, err)
+		assert.NoError(t, json.Unmarshal(data, &mtd))
+		assert.Equal(t, "getScenes", mtd.Method)
+
+		packet, _ := json.Marshal(&Reply{
+			Type:   typeReply,
+			ID:     mtd.ID,
+			Result: json.RawMessage(`{"scenes":[{"sceneID":"default","controls":[{"controlID":"jump","kind":"button","text":"Jump"}]}]}`),
+		})
+		send(string(packet))
+		conn.ReadMessage()
+	}))
+}
+
+func TestConnection(t *testing.T) {
+	srv := gameServer(t)
+	defer srv.Close()
+
+	dial, _, err := ws.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), http.Header{
+		"Authorization":      {"Bearer token"},
+		"X-Protocol-Version": {protocolVersion},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := NewConnection(dial)
+	defer conn.Close()
+
+	joined := make(chan *ParticipantJoin, 1)
+	conn.Handle(func(evt *ParticipantJoin) { joined <- evt })
+	inputs := make(chan *GiveInput, 1)
+	conn.Handle(func(evt *GiveInput) { inputs <- evt })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	scheme, err := conn.SetCompression(ctx, "gzip", "none")
+	assert.NoError(t, err)
+	assert.Equal(t, "gzip", scheme)
+
+	select {
+	case evt := <-joined:
+		if assert.Len(t, evt.Participants, 1) {
+			assert.Equal(t, "connor", evt.Participants[0].UserName)
+		}
+	case <-ctx.Done():
+		t.Fatal("onParticipantJoin was not handled")
+	}
+
+	select {
+	case evt := <-inputs:
+		assert.Equal(t, "s1", evt.ParticipantID)
+		assert.Equal(t, "t1", evt.TransactionID)
+		assert.Equal(t, "jump", evt.Input.ControlID)
+		assert.Equal(t, "mousedown", evt.Input.Event)
+	case <-ctx.Done():
+		t.Fatal("giveInput was not handled")
+	}
+
+	scenes, err := conn.GetScenes(ctx)
+	assert.NoError(t, err)
+	if assert.Len(t, scenes, 1) && assert.Len(t, scenes[0].Controls, 1) {
+		assert.Equal(t, "Jump", scenes[0].Controls[0].Text)
+	}
+}
+
+func TestPartialUpdates(t *testing.T) {
+	// Unset fields are left out, so the server keeps them.
+	data, err := json.Marshal(Control{ControlID: "jump", Text: "Jump"})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"controlID":"jump","text":"Jump"}`, string(data))
+
+	data, err = json.Marshal(Participant{SessionID: "s1", GroupID: "vip"})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"sessionID":"s1","groupID":"vip"}`, string(data))
+
+	// Fields set to zero are sent.
+	data, err = json.Marshal(Control{ControlID: "jump", Disabled: Bool(false), Cost: Int(0), Progress: Float64(0)})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"controlID":"jump","disabled":false,"cost":0,"progress":0}`, string(data))
+
+	data, err = json.Marshal(Participant{SessionID: "s1", Disabled: Bool(false)})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"sessionID":"s1","disabled":false}`, string(data))
+}
@@ -0,0 +1,140 @@
+package interactive
+
+import "context"
+
+// Ready tells the server whether the game is ready to receive input.
+func (c *Connection) Ready(ctx context.Context, isReady bool) error {
+	params := struct {
+		IsReady bool `json:"isReady"`
+	}{isReady}
+
+	return c.Call(ctx, "ready", params, nil)
+}
+
+// GetScenes returns the scenes of the game with their controls.
+func (c *Connection) GetScenes(ctx context.Context) ([]Scene, error) {
+	var result struct {
+		Scenes []Scene `json:"scenes"`
+	}
+	if err := c.Call(ctx, "getScenes", struct{}{}, &result); err != nil {
+		return nil, err
+	}
+
+	return result.Scenes, nil
+}
+
+// GetGroups returns the groups of the game.
+func (c *Connection) GetGroups(ctx context.Context) ([]Group, error) {
+	var result struct {
+		Groups []Group `json:"groups"`
+	}
+	if err := c.Call(ctx, "getGroups", struct{}{}, &result); err != nil {
+		return nil, err
+	}
+
+	return result.Groups, nil
+}
+
+// GetActiveParticipants returns the participants connected now.
+func (c *Connection) GetActiveParticipants(ctx context.Context) ([]Participant, error) {
+	var result struct {
+		Participants []Participant `json:"participants"`
+	}
+	params := struct {
+		From int64 `json:"from"`
+	}{0}
+	if err := c.Call(ctx, "getActiveParticipants", params, &result); err != nil {
+		return nil, err
+	}
+
+	return result.Participants, nil
+}
+
+// CreateControls adds the controls to the scene and returns them as created.
+func (c *Connection) CreateControls(ctx context.Context, sceneID string, controls ...Control) ([]Control, error) {
+	params := struct {
+		SceneID  string    `json:"sceneID"`
+		Controls []Control `json:"controls"`
+	}{sceneID, controls}
+
+	var result struct {
+		Controls []Control `json:"controls"`
+	}
+	if err := c.Call(ctx, "createControls", params, &result); err != nil {
+		return nil, err
+	}
+
+	return result.Controls, nil
+}
+
+// UpdateControls changes the controls of the scene and returns them as
+// updated. Updates with a higher priority win over the concurrent ones.
+func (c *Connection) UpdateControls(ctx context.Context, sceneID string, priority int, controls ...Control) ([]Control, error) {
+	params := struct {
+		SceneID  string    `json:"sceneID"`
+		Priority int       `json:"priority"`
+		Controls []Control `json:"controls"`
+	}{sceneID, priority, controls}
+
+	var result struct {
+		Controls []Control `json:"controls"`
+	}
+	if err := c.Call(ctx, "updateControls", params, &result); err != nil {
+		return nil, err
+	}
+
+	return result.Controls, nil
+}
+
+// CreateGroups adds the groups and returns them as created.
+func (c *Connection) CreateGroups(ctx context.Context, groups ...Group) ([]Group, error) {
+	params := struct {
+		Groups []Group `json:"groups"`
+	}{groups}
+
+	var result struct {
+		Groups []Group `json:"groups"`
+	}
+	if err := c.Call(ctx, "createGroups", params, &result); err != nil {
+		return nil, err
+	}
+
+	return result.Groups, nil
+}
+
+// UpdateParticipants changes the participants, like moving them to another
+// group, and returns them as updated.
+func (c *Connection) UpdateParticipants(ctx context.Context, priority int, participants ...Participant) ([]Participant, error) {
+	params := struct {
+		Priority     int           `json:"priority"`
+		Participants []Participant `json:"participants"`
+	}{priority, participants}
+
+	var result struct {
+		Participants []Participant `json:"participants"`
+	}
+	if err := c.Call(ctx, "updateParticipants", params, &result); err != nil {
+		return nil, err
+	}
+
+	return result.Participants, nil
+}
+
+// GiveInput sends an input on a control, as a participant does.
+func (c *Connection) GiveInput(ctx context.Context, input *Input) error {
+	params := struct {
+		Input *Input `json:"input"`
+	}{input}
+
+	return c.Call(ctx, "giveInput", params, nil)
+}
+
+// Capture charges the sparks of the input transaction. Inputs which are not
+// captured are free for the participant.
+func (c *Connection) Capture(ctx context.Context, transactionID string) error {
+	params := struct {
+		TransactionID string `json:"transactionID"`
+	}{transactionID}
+
+	return c.Call(ctx, "capture", params, nil)
+}
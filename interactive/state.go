@@ -0,0 +1,443 @@
+package interactive
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+type (
+	// State is the tree of scenes, controls, groups and participants of a
+	// game, kept in sync with the server events. It is safe for concurrent
+	// use, queries return copies which the caller may change freely. Meta
+	// values are shared with the state and must not be changed in place.
+	State struct {
+		conn   *Connection
+		remove func()
+
+		mu           sync.RWMutex
+		scenes       map[string]Scene
+		groups       map[string]Group
+		participants map[string]Participant
+
+		// The events received while syncing, applied to the fetched state.
+		syncing int
+		pending []interface{}
+	}
+
+	// Snapshot is a copy of the whole state at some moment.
+	Snapshot struct {
+		Scenes       []Scene
+		Groups       []Group
+		Participants []Participant
+	}
+)
+
+// NewState returns an empty state which follows the events of the
+// connection. Use Sync to fetch what already exists.
+func NewState(conn *Connection) *State {
+	s := &State{
+		conn:         conn,
+		scenes:       make(map[string]Scene),
+		groups:       make(map[string]Group),
+		participants: make(map[string]Participant),
+	}
+	s.remove = conn.Handle(s.apply)
+
+	return s
+}
+
+// Close stops following the events.
+func (s *State) Close() {
+	s.remove()
+}
+
+// Sync replaces the state with the scenes, groups and active participants
+// fetched from the server. The events received meanwhile are applied over
+// them, as the fetches may miss their changes.
+func (s *State) Sync(ctx context.Context) error {
+	s.mu.Lock()
+	s.syncing++
+	start := len(s.pending)
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		if s.syncing--; s.syncing == 0 {
+			s.pending = nil
+		}
+		s.mu.Unlock()
+	}()
+
+	scenes, err := s.conn.GetScenes(ctx)
+	if err != nil {
+		return err
+	}
+
+	groups, err := s.conn.GetGroups(ctx)
+	if err != nil {
+		return err
+	}
+
+	participants, err := s.conn.GetActiveParticipants(ctx)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.scenes = make(map[string]Scene, len(scenes))
+	for _, scene := range scenes {
+		s.scenes[scene.SceneID] = scene
+	}
+	s.groups = make(map[string]Group, len(groups))
+	for _, group := range groups {
+		s.groups[group.GroupID] = group
+	}
+	s.participants = make(map[string]Participant, len(participants))
+	for _, participant := range participants {
+		s.participants[participant.SessionID] = participant
+	}
+	for _, evt := range s.pending[start:] {
+		s.change(evt)
+	}
+
+	return nil
+}
+
+// Scene returns the scene with its controls.
+func (s *State) Scene(sceneID string) (Scene, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	scene, ok := s.scenes[sceneID]
+	return copyScene(scene), ok
+}
+
+// Scenes returns every scene ordered by ID.
+func (s *State) Scenes() []Scene {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	scenes := make([]Scene, 0, len(s.scenes))
+	for _, scene := range s.scenes {
+		scenes = append(scenes, copyScene(scene))
+	}
+	sort.Slice(scenes, func(i, j int) bool { return scenes[i].SceneID < scenes[j].SceneID })
+
+	return scenes
+}
+
+// Control returns the control of the scene.
+func (s *State) Control(sceneID, controlID string) (Control, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	scene := s.scenes[sceneID]
+	if i := indexControl(scene.Controls, controlID); i >= 0 {
+		return copyControl(scene.Controls[i]), true
+	}
+
+	return Control{}, false
+}
+
+// Group returns the group.
+func (s *State) Group(groupID string) (Group, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	group, ok := s.groups[groupID]
+	return group, ok
+}
+
+// Groups returns every group ordered by ID.
+func (s *State) Groups() []Group {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	groups := make([]Group, 0, len(s.groups))
+	for _, group := range s.groups {
+		groups = append(groups, group)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].GroupID < groups[j].GroupID })
+
+	return groups
+}
+
+// Participant returns the participant by session ID.
+func (s *State) Participant(sessionID string) (Participant, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	participant, ok := s.participants[sessionID]
+	return copyParticipant(participant), ok
+}
+
+// Participants returns the participants of the group ordered by session ID,
+// or every participant if groupID is empty.
+func (s *State) Participants(groupID string) []Participant {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var participants []Participant
+	for _, participant := range s.participants {
+		if groupID == "" || participant.GroupID == groupID {
+			participants = append(participants, copyParticipant(participant))
+		}
+	}
+	sort.Slice(participants, func(i, j int) bool {
+		return participants[i].SessionID < participants[j].SessionID
+	})
+
+	return participants
+}
+
+// Snapshot returns a copy of the whole state.
+func (s *State) Snapshot() *Snapshot {
+	return &Snapshot{
+		Scenes:       s.Scenes(),
+		Groups:       s.Groups(),
+		Participants: s.Participants(""),
+	}
+}
+
+// UpdateControl changes a copy of the control with fn and sends the changed
+// properties to the server. The state is updated once the server accepts the
+// change.
+func (s *State) UpdateControl(ctx context.Context, sceneID, controlID string, fn func(*Control)) error {
+	old, ok := s.Control(sceneID, controlID)
+	if !ok {
+		return fmt.Errorf("interactive: no control %q in scene %q", controlID, sceneID)
+	}
+
+	upd := copyControl(old)
+	fn(&upd)
+
+	diff := diffControl(&old, &upd)
+	if len(diff) == 0 {
+		return nil
+	}
+	diff["controlID"] = controlID
+	if old.Etag != "" {
+		diff["etag"] = old.Etag
+	}
+
+	params := struct {
+		SceneID  string                   `json:"sceneID"`
+		Controls []map[string]interface{} `json:"controls"`
+	}{sceneID, []map[string]interface{}{diff}}
+
+	var result struct {
+		Controls []Control `json:"controls"`
+	}
+	if err := s.conn.Call(ctx, "updateControls", params, &result); err != nil {
+		return err
+	}
+	if len(result.Controls) == 0 {
+		result.Controls = []Control{upd}
+	}
+
+	s.mu.Lock()
+	s.upsertControls(sceneID, result.Controls)
+	s.mu.Unlock()
+
+	return nil
+}
+
+// apply changes the state by an event.
+func (s *State) apply(evt interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.syncing > 0 {
+		s.pending = append(s.pending, evt)
+	}
+	s.change(evt)
+}
+
+// change applies an event to the state. Called with the lock held.
+func (s *State) change(evt interface{}) {
+	switch evt := evt.(type) {
+	case *SceneCreate:
+		s.upsertScenes(evt.Scenes)
+	case *SceneUpdate:
+		s.upsertScenes(evt.Scenes)
+	case *SceneDelete:
+		delete(s.scenes, evt.SceneID)
+		for id, group := range s.groups {
+			if group.SceneID == evt.SceneID {
+				group.SceneID = evt.ReassignSceneID
+				s.groups[id] = group
+			}
+		}
+	case *ControlCreate:
+		s.upsertControls(evt.SceneID, evt.Controls)
+	case *ControlUpdate:
+		s.upsertControls(evt.SceneID, evt.Controls)
+	case *ControlDelete:
+		scene, ok := s.scenes[evt.SceneID]
+		if !ok {
+			return
+		}
+		controls := make([]Control, 0, len(scene.Controls))
+		for _, control := range scene.Controls {
+			if indexControl(evt.Controls, control.ControlID) < 0 {
+				controls = append(controls, control)
+			}
+		}
+		scene.Controls = controls
+		s.scenes[evt.SceneID] = scene
+	case *GroupCreate:
+		s.upsertGroups(evt.Groups)
+	case *GroupUpdate:
+		s.upsertGroups(evt.Groups)
+	case *GroupDelete:
+		delete(s.groups, evt.GroupID)
+		for id, participant := range s.participants {
+			if participant.GroupID == evt.GroupID {
+				participant.GroupID = evt.ReassignGroupID
+				s.participants[id] = participant
+			}
+		}
+	case *ParticipantJoin:
+		s.upsertParticipants(evt.Participants)
+	case *ParticipantUpdate:
+		s.upsertParticipants(evt.Participants)
+	case *ParticipantLeave:
+		for _, participant := range evt.Participants {
+			delete(s.participants, participant.SessionID)
+		}
+	}
+}
+
+// upsertScenes stores the scenes, keeping the known controls of the scenes
+// sent without them.
+func (s *State) upsertScenes(scenes []Scene) {
+	for _, scene := range scenes {
+		if scene.Controls == nil {
+			scene.Controls = s.scenes[scene.SceneID].Controls
+		}
+		s.scenes[scene.SceneID] = scene
+	}
+}
+
+func (s *State) upsertControls(sceneID string, controls []Control) {
+	scene, ok := s.scenes[sceneID]
+	if !ok {
+		scene = Scene{SceneID: sceneID}
+	}
+
+	scene.Controls = append([]Control(nil), scene.Controls...)
+	for _, control := range controls {
+		if i := indexControl(scene.Controls, control.ControlID); i >= 0 {
+			scene.Controls[i] = control
+		} else {
+			scene.Controls = append(scene.Controls, control)
+		}
+	}
+	s.scenes[sceneID] = scene
+}
+
+func (s *State) upsertGroups(groups []Group) {
+	for _, group := range groups {
+		s.groups[group.GroupID] = group
+	}
+}
+
+func (s *State) upsertParticipants(participants []Participant) {
+	for _, participant := range participants {
+		s.participants[participant.SessionID] = participant
+	}
+}
+
+func indexControl(controls []Control, controlID string) int {
+	for i := range controls {
+		if controls[i].ControlID == controlID {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func copyScene(scene Scene) Scene {
+	if scene.Controls != nil {
+		controls := make([]Control, len(scene.Controls))
+		for i := range scene.Controls {
+			controls[i] = copyControl(scene.Controls[i])
+		}
+		scene.Controls = controls
+	}
+
+	return scene
+}
+
+func copyControl(control Control) Control {
+	if control.Disabled != nil {
+		control.Disabled = Bool(*control.Disabled)
+	}
+	if control.Cost != nil {
+		control.Cost = Int(*control.Cost)
+	}
+	if control.Progress != nil {
+		control.Progress = Float64(*control.Progress)
+	}
+	if control.Position != nil {
+		control.Position = append([]Position(nil), control.Position...)
+	}
+	if control.Meta != nil {
+		meta := make(map[string]interface{}, len(control.Meta))
+		for k, v := range control.Meta {
+			meta[k] = v
+		}
+		control.Meta = meta
+	}
+
+	return control
+}
+
+// diffControl returns the properties which differ between the controls, by
+// their JSON names.
+func diffControl(old, upd *Control) map[string]interface{} {
+	diff := make(map[string]interface{})
+	if upd.Disabled != nil && !reflect.DeepEqual(old.Disabled, upd.Disabled) {
+		diff["disabled"] = *upd.Disabled
+	}
+	if !reflect.DeepEqual(old.Position, upd.Position) {
+		diff["position"] = upd.Position
+	}
+	if old.Text != upd.Text {
+		diff["text"] = upd.Text
+	}
+	if old.Tooltip != upd.Tooltip {
+		diff["tooltip"] = upd.Tooltip
+	}
+	if upd.Cost != nil && !reflect.DeepEqual(old.Cost, upd.Cost) {
+		diff["cost"] = *upd.Cost
+	}
+	if upd.Progress != nil && !reflect.DeepEqual(old.Progress, upd.Progress) {
+		diff["progress"] = *upd.Progress
+	}
+	if old.Cooldown != upd.Cooldown {
+		diff["cooldown"] = upd.Cooldown
+	}
+	if old.KeyCode != upd.KeyCode {
+		diff["keyCode"] = upd.KeyCode
+	}
+	if !reflect.DeepEqual(old.Meta, upd.Meta) {
+		diff["meta"] = upd.Meta
+	}
+
+	return diff
+}
+
+func copyParticipant(participant Participant) Participant {
+	if participant.Disabled != nil {
+		participant.Disabled = Bool(*participant.Disabled)
+	}
+
+	return participant
+}
@@ -0,0 +1,194 @@
+package interactive
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	ws "github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStateApply(t *testing.T) {
+	s := &State{
+		scenes:       make(map[string]Scene),
+		groups:       make(map[string]Group),
+		participants: make(map[string]Participant),
+	}
+
+	s.apply(&SceneCreate{Scenes: []Scene{{SceneID: "default"}, {SceneID: "lobby"}}})
+	s.apply(&ControlCreate{SceneID: "default", Controls: []Control{
+		{ControlID: "jump", Kind: "button", Text: "Jump"},
+		{ControlID: "duck", Kind: "button", Text: "Duck"},
+	}})
+	s.apply(&ControlUpdate{SceneID: "default", Controls: []Control{{ControlID: "jump", Kind: "button", Text: "JUMP"}}})
+	s.apply(&ControlDelete{SceneID: "default", Controls: []Control{{ControlID: "duck"}}})
+	s.apply(&GroupCreate{Groups: []Group{{GroupID: "default", SceneID: "default"}, {GroupID: "vip", SceneID: "lobby"}}})
+	s.apply(&ParticipantJoin{Participants: []Participant{
+		{SessionID: "a", UserName: "connor", GroupID: "default"},
+		{SessionID: "b", UserName: "matt", GroupID: "vip"},
+		{SessionID: "c", UserName: "james", GroupID: "vip"},
+	}})
+	s.apply(&ParticipantLeave{Participants: []Participant{{SessionID: "c"}}})
+	s.apply(&SceneDelete{SceneID: "lobby", ReassignSceneID: "default"})
+	s.apply(&GroupDelete{GroupID: "vip", ReassignGroupID: "default"})
+
+	control, ok := s.Control("default", "jump")
+	assert.True(t, ok)
+	assert.Equal(t, "JUMP", control.Text)
+	_, ok = s.Control("default", "duck")
+	assert.False(t, ok)
+
+	snapshot := s.Snapshot()
+	if assert.Len(t, snapshot.Scenes, 1) {
+		assert.Equal(t, "default", snapshot.Scenes[0].SceneID)
+		assert.Len(t, snapshot.Scenes[0].Controls, 1)
+	}
+	assert.Equal(t, []Group{{GroupID: "default", SceneID: "default"}}, snapshot.Groups)
+	if participants := s.Participants("default"); assert.Len(t, participants, 2) {
+		assert.Equal(t, "connor", participants[0].UserName)
+		assert.Equal(t, "matt", participants[1].UserName)
+	}
+
+	// Copies do not leak changes back into the state.
+	snapshot.Scenes[0].Controls[0].Text = "changed"
+	control, _ = s.Control("default", "jump")
+	assert.Equal(t, "JUMP", control.Text)
+}
+
+func TestStateUpdateControl(t *testing.T) {
+	upgrader := ws.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		// The control is created once the game is ready.
+		var mtd Method
+		if err := conn.ReadJSON(&mtd); err != nil {
+			return
+		}
+		conn.WriteJSON(&Reply{Type: typeReply, ID: mtd.ID})
+
+		conn.WriteJSON(&Method{
+			Type:    typeMethod,
+			Method:  EventControlCreate,
+			Params:  json.RawMessage(`{"sceneID":"default","controls":[{"controlID":"jump","kind":"button","text":"Jump","cost":10,"etag":"e1"}]}`),
+			Discard: true,
+		})
+
+		if err := conn.ReadJSON(&mtd); err != nil {
+			return
+		}
+		assert.Equal(t, "updateControls", mtd.Method)
+		assert.JSONEq(t, `{"sceneID":"default","controls":[{"controlID":"jump","etag":"e1","disabled":true}]}`, string(mtd.Params))
+		conn.WriteJSON(&Reply{
+			Type:   typeReply,
+			ID:     mtd.ID,
+			Result: json.RawMessage(`{"controls":[{"controlID":"jump","kind":"button","text":"Jump","cost":10,"disabled":true,"etag":"e2"}]}`),
+		})
+		conn.ReadMessage()
+	}))
+	defer srv.Close()
+
+	dial, _, err := ws.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := NewConnection(dial)
+	defer conn.Close()
+
+	s := NewState(conn)
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	assert.NoError(t, conn.Ready(ctx, true))
+	for {
+		if _, ok := s.Control("default", "jump"); ok {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatal("onControlCreate was not applied")
+		case <-time.After(time.Millisecond):
+		}
+	}
+
+	err = s.UpdateControl(ctx, "default", "jump", func(control *Control) { control.Disabled = Bool(true) })
+	assert.NoError(t, err)
+
+	control, _ := s.Control("default", "jump")
+	if assert.NotNil(t, control.Disabled) {
+		assert.True(t, *control.Disabled)
+	}
+	assert.Equal(t, Int(10), control.Cost)
+	assert.Equal(t, "e2", control.Etag)
+}
+
+func TestStateSync(t *testing.T) {
+	upgrader := ws.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		event := func(method, params string) {
+			conn.WriteJSON(&Method{Type: typeMethod, Method: method, Params: json.RawMessage(params), Discard: true})
+		}
+		results := map[string]string{
+			"getScenes":             `{"scenes":[{"sceneID":"default","controls":[{"controlID":"jump","kind":"button","text":"Jump"}]}]}`,
+			"getGroups":             `{"groups":[{"groupID":"default","sceneID":"default"}]}`,
+			"getActiveParticipants": `{"participants":[{"sessionID":"a","username":"connor","groupID":"default"}]}`,
+		}
+		for i := 0; i < len(results); i++ {
+			var mtd Method
+			if err := conn.ReadJSON(&mtd); err != nil {
+				return
+			}
+
+			// Changes happen between the fetches, and the last fetch
+			// does not see them yet.
+			if mtd.Method == "getGroups" {
+				event(EventControlUpdate, `{"sceneID":"default","controls":[{"controlID":"jump","kind":"button","text":"JUMP"}]}`)
+				event(EventParticipantJoin, `{"participants":[{"sessionID":"b","username":"matt","groupID":"default"}]}`)
+				event(EventParticipantLeave, `{"participants":[{"sessionID":"a"}]}`)
+			}
+			conn.WriteJSON(&Reply{Type: typeReply, ID: mtd.ID, Result: json.RawMessage(results[mtd.Method])})
+		}
+		conn.ReadMessage()
+	}))
+	defer srv.Close()
+
+	dial, _, err := ws.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := NewConnection(dial)
+	defer conn.Close()
+
+	s := NewState(conn)
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	assert.NoError(t, s.Sync(ctx))
+
+	control, ok := s.Control("default", "jump")
+	assert.True(t, ok)
+	assert.Equal(t, "JUMP", control.Text)
+	if participants := s.Participants(""); assert.Len(t, participants, 1) {
+		assert.Equal(t, "matt", participants[0].UserName)
+	}
+	assert.Empty(t, s.pending)
+}
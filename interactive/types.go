@@ -0,0 +1,109 @@
+package interactive
+
+import "encoding/json"
+
+type (
+	// Scene is a set of controls shown to the participants of a group.
+	Scene struct {
+		SceneID  string                 `json:"sceneID"`
+		Controls []Control              `json:"controls,omitempty"`
+		Meta     map[string]interface{} `json:"meta,omitempty"`
+		Etag     string                 `json:"etag,omitempty"`
+	}
+
+	// Control is a button, joystick or other input of a scene. Kind specific
+	// properties which have no field are kept in Meta. Disabled, Cost and
+	// Progress are left out of partial updates when nil, set them with Bool,
+	// Int and Float64, zero included.
+	Control struct {
+		ControlID string     `json:"controlID"`
+		Kind      string     `json:"kind,omitempty"` // (button, joystick, label, textbox, screen)
+		Disabled  *bool      `json:"disabled,omitempty"`
+		Position  []Position `json:"position,omitempty"`
+		Text      string     `json:"text,omitempty"`
+		Tooltip   string     `json:"tooltip,omitempty"`
+
+		// The cost of the button in sparks.
+		Cost *int `json:"cost,omitempty"`
+
+		// The progress bar of the button, from 0 to 1.
+		Progress *float64 `json:"progress,omitempty"`
+
+		// The end of the button cooldown as Unix milliseconds.
+		Cooldown int64 `json:"cooldown,omitempty"`
+
+		// The JavaScript keycode bound to the button.
+		KeyCode int `json:"keyCode,omitempty"`
+
+		Meta map[string]interface{} `json:"meta,omitempty"`
+		Etag string                 `json:"etag,omitempty"`
+	}
+
+	// Position places a control on the grid of a screen size.
+	Position struct {
+		Size   string `json:"size"` // (large, medium, small)
+		Width  int    `json:"width"`
+		Height int    `json:"height"`
+		X      int    `json:"x"`
+		Y      int    `json:"y"`
+	}
+
+	// Group is a set of participants which are shown the same scene.
+	Group struct {
+		GroupID string                 `json:"groupID"`
+		SceneID string                 `json:"sceneID,omitempty"`
+		Meta    map[string]interface{} `json:"meta,omitempty"`
+		Etag    string                 `json:"etag,omitempty"`
+	}
+
+	// Participant is a viewer connected to the game.
+	Participant struct {
+		SessionID string `json:"sessionID"`
+		UserID    uint   `json:"userID,omitempty"`
+		UserName  string `json:"username,omitempty"`
+		Level     uint   `json:"level,omitempty"`
+
+		// Unix milliseconds of the last input and of the connect.
+		LastInputAt int64 `json:"lastInputAt,omitempty"`
+		ConnectedAt int64 `json:"connectedAt,omitempty"`
+
+		// Left out of partial updates when nil, see Bool.
+		Disabled *bool                  `json:"disabled,omitempty"`
+		GroupID  string                 `json:"groupID,omitempty"`
+		Meta     map[string]interface{} `json:"meta,omitempty"`
+		Etag     string                 `json:"etag,omitempty"`
+	}
+
+	// Input is an interaction with a control. Raw holds the whole input, as
+	// fields depend on the control kind.
+	Input struct {
+		ControlID string  `json:"controlID"`
+		Event     string  `json:"event"` // (mousedown, mouseup, move, keydown, keyup, submit, change)
+		Button    int     `json:"button,omitempty"`
+		X         float64 `json:"x,omitempty"`
+		Y         float64 `json:"y,omitempty"`
+		Value     string  `json:"value,omitempty"`
+
+		Raw json.RawMessage `json:"-"`
+	}
+)
+
+// Bool returns a pointer to v, for the optional fields of updates.
+func Bool(v bool) *bool { return &v }
+
+// Int returns a pointer to v, for the optional fields of updates.
+func Int(v int) *int { return &v }
+
+// Float64 returns a pointer to v, for the optional fields of updates.
+func Float64(v float64) *float64 { return &v }
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (in *Input) UnmarshalJSON(data []byte) error {
+	type input Input
+	if err := json.Unmarshal(data, (*input)(in)); err != nil {
+		return err
+	}
+
+	in.Raw = append(in.Raw[:0], data...)
+	return nil
+}
@@ -0,0 +1,30 @@
+package beam
+
+import (
+	"context"
+	"fmt"
+)
+
+// InvoicesService handles communication with the invoice related methods of
+// the API.
+type InvoicesService service
+
+// Get returns an invoice by ID, requires the invoice:view:self scope.
+func (s *InvoicesService) Get(ctx context.Context, invoiceID uint) (*Invoice, error) {
+	var invoice Invoice
+	if err := s.client.get(ctx, fmt.Sprintf("invoices/%d", invoiceID), &invoice); err != nil {
+		return nil, err
+	}
+
+	return &invoice, nil
+}
+
+// List returns the invoices of the user, requires the invoice:view:self scope.
+func (s *InvoicesService) List(ctx context.Context, userID uint) ([]Invoice, error) {
+	var invoices []Invoice
+	if err := s.client.get(ctx, fmt.Sprintf("users/%d/invoices", userID), &invoices); err != nil {
+		return nil, err
+	}
+
+	return invoices, nil
+}
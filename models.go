@@ -5,6 +5,7 @@ import "time"
 type (
 	Error struct {
 		Error      string `json:"error"`
+		Message    string `json:"message"`
 		StatusCode int    `json:"statusCode"`
 	}
 
@@ -186,6 +187,23 @@ type (
 		ChannelTweetBody string `json:"channel:tweet:body"`
 	}
 
+	ChatDetails struct {
+		// The roles the user has in the chat, empty for anonymous users.
+		Roles []string `json:"roles"`
+
+		// The key to authenticate in the chat with, empty for anonymous users.
+		AuthKey string `json:"authkey"`
+
+		// The chat permissions of the user.
+		Permissions []string `json:"permissions"`
+
+		// The chat servers to connect to.
+		Endpoints []string `json:"endpoints"`
+
+		// Indicates that the chat servers shed load and may drop connections.
+		IsLoadShed bool `json:"isLoadShed"`
+	}
+
 	ChatUser struct {
 		// The user ID that this chat user belongs to.
 		UserID uint
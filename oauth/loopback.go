@@ -0,0 +1,190 @@
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html/template"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+
+	oauth2 "golang.org/x/oauth2"
+)
+
+// ErrStateMismatch is shown to a redirect which carries a state other than the
+// one sent with the authorization request.
+var ErrStateMismatch = errors.New("oauth: state mismatch")
+
+type (
+	// AuthError is an error returned by the authorization server in the
+	// redirect, like "access_denied" when the user declined.
+	AuthError struct {
+		Code        string
+		Description string
+	}
+
+	// LoginOption configures LoopbackLogin.
+	LoginOption func(*login)
+
+	login struct {
+		addr string
+		pkce bool
+	}
+)
+
+var loginPage = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html>
+<head><title>{{.}}</title></head>
+<body><p>{{.}}</p></body>
+</html>
+`))
+
+// WithAddr sets the address to listen on, like "127.0.0.1:8080" for a port
+// registered with the OAuth client. A random port of 127.0.0.1 is used by
+// default.
+func WithAddr(addr string) LoginOption {
+	return func(l *login) { l.addr = addr }
+}
+
+// WithPKCE protects the code by a S256 code challenge, for clients which can
+// not keep their secret.
+func WithPKCE() LoginOption {
+	return func(l *login) { l.pkce = true }
+}
+
+// LoopbackLogin logs the user in from a desktop tool. It listens on a loopback
+// address, passes the authorization URL redirecting there to open, which
+// usually starts a browser or prints the URL, and waits for the redirect. The
+// path of the config redirect URL is kept, its host is replaced by the
+// listener. A request whose state does not match, like one forged by another
+// page, is answered with ErrStateMismatch and the login keeps waiting for the
+// real redirect. The listener is shut down once the token is exchanged, or the
+// context is done.
+func (cfg *Config) LoopbackLogin(ctx context.Context, open func(authURL string) error, opts ...LoginOption) (*Token, error) {
+	l := &login{addr: "127.0.0.1:0"}
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	path := "/"
+	if u, err := url.Parse(cfg.RedirectURL); err == nil && u.Path != "" {
+		path = u.Path
+	}
+
+	ln, err := net.Listen("tcp", l.addr)
+	if err != nil {
+		return nil, err
+	}
+
+	// The config is copied so the redirect URL of the listener does not leak
+	// into the shared one.
+	conf := *cfg.Config
+	conf.RedirectURL = (&url.URL{Scheme: "http", Host: ln.Addr().String(), Path: path}).String()
+	local := &Config{Config: &conf, ShortcodeURL: cfg.ShortcodeURL}
+
+	state, err := randomString()
+	if err != nil {
+		ln.Close()
+		return nil, err
+	}
+
+	var authOpts, exchangeOpts []oauth2.AuthCodeOption
+	if l.pkce {
+		verifier, err := randomString()
+		if err != nil {
+			ln.Close()
+			return nil, err
+		}
+		sum := sha256.Sum256([]byte(verifier))
+		authOpts = append(authOpts,
+			oauth2.SetAuthURLParam("code_challenge", base64.RawURLEncoding.EncodeToString(sum[:])),
+			oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+		)
+		exchangeOpts = append(exchangeOpts, oauth2.SetAuthURLParam("code_verifier", verifier))
+	}
+
+	type result struct {
+		token *Token
+		err   error
+	}
+	var (
+		once sync.Once
+		done = make(chan result, 1)
+	)
+	mux := http.NewServeMux()
+	mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != path {
+			http.NotFound(w, r)
+			return
+		}
+
+		token, err := local.callback(ctx, r, state, exchangeOpts)
+
+		title := "Logged in, you may close this window."
+		status := http.StatusOK
+		if err != nil {
+			title = "Login failed: " + err.Error()
+			status = http.StatusBadRequest
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(status)
+		loginPage.Execute(w, title)
+
+		if err == ErrStateMismatch {
+			return
+		}
+		once.Do(func() { done <- result{token, err} })
+	})
+
+	srv := &http.Server{Handler: mux}
+	go srv.Serve(ln)
+	defer srv.Shutdown(context.Background())
+
+	if err := open(local.AuthCodeURL(state, authOpts...)); err != nil {
+		return nil, err
+	}
+
+	select {
+	case res := <-done:
+		return res.token, res.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// callback checks the redirect and exchanges its code.
+func (cfg *Config) callback(ctx context.Context, r *http.Request, state string, opts []oauth2.AuthCodeOption) (*Token, error) {
+	query := r.URL.Query()
+	if query.Get("state") != state {
+		return nil, ErrStateMismatch
+	}
+	if code := query.Get("error"); code != "" {
+		return nil, &AuthError{Code: code, Description: query.Get("error_description")}
+	}
+
+	return cfg.Exchange(ctx, query.Get("code"), opts...)
+}
+
+// Error implements the error interface.
+func (e *AuthError) Error() string {
+	if e.Description != "" {
+		return fmt.Sprintf("oauth: %s: %s", e.Code, e.Description)
+	}
+
+	return "oauth: " + e.Code
+}
+
+// randomString returns 32 random bytes encoded for URLs.
+func randomString() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
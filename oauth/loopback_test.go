@@ -0,0 +1,106 @@
+package oauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// browser follows the authorization URL like the authorization server would,
+// redirecting back with the query, and keeps the page shown.
+func browser(t *testing.T, query url.Values, page *string) func(string) error {
+	return func(authURL string) error {
+		u, err := url.Parse(authURL)
+		if err != nil {
+			return err
+		}
+		redirect := u.Query().Get("redirect_uri")
+		assert.True(t, strings.HasPrefix(redirect, "http://127.0.0.1:"), redirect)
+		assert.True(t, strings.HasSuffix(redirect, "/callback"), redirect)
+
+		if query.Get("state") == "" {
+			query.Set("state", u.Query().Get("state"))
+		}
+		query.Set("challenge", u.Query().Get("code_challenge"))
+
+		resp, err := http.Get(redirect + "?" + query.Encode())
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		data, err := ioutil.ReadAll(resp.Body)
+		*page = string(data)
+		return err
+	}
+}
+
+func TestLoopbackLogin(t *testing.T) {
+	var challenge string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseForm())
+		assert.Equal(t, "code", r.PostForm.Get("code"))
+		sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		assert.Equal(t, challenge, base64.RawURLEncoding.EncodeToString(sum[:]))
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"access","token_type":"Bearer","expires_in":3600}`))
+	}))
+	defer srv.Close()
+
+	cfg := NewClient("id", "secret", "http://localhost/callback")
+	cfg.Endpoint.TokenURL = srv.URL
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var page string
+	query := url.Values{"code": {"code"}}
+	open := browser(t, query, &page)
+	token, err := cfg.LoopbackLogin(ctx, func(authURL string) error {
+		u, _ := url.Parse(authURL)
+		challenge = u.Query().Get("code_challenge")
+		assert.Equal(t, "S256", u.Query().Get("code_challenge_method"))
+		return open(authURL)
+	}, WithPKCE())
+	if assert.NoError(t, err) {
+		assert.Equal(t, "access", token.AccessToken)
+	}
+	assert.Contains(t, page, "Logged in")
+	assert.Equal(t, "http://localhost/callback", cfg.RedirectURL)
+}
+
+func TestLoopbackLoginErrors(t *testing.T) {
+	cfg := NewClient("id", "secret", "http://localhost/callback")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// A forged redirect is refused, and the login goes on with the real one.
+	var page, forgedPage string
+	forged := browser(t, url.Values{"state": {"forged"}, "code": {"code"}}, &forgedPage)
+	real := browser(t, url.Values{"error": {"access_denied"}}, &page)
+	_, err := cfg.LoopbackLogin(ctx, func(authURL string) error {
+		if err := forged(authURL); err != nil {
+			return err
+		}
+		return real(authURL)
+	})
+	assert.Contains(t, forgedPage, "Login failed: "+ErrStateMismatch.Error())
+	if aerr, ok := err.(*AuthError); assert.True(t, ok, "%v", err) {
+		assert.Equal(t, "access_denied", aerr.Code)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	_, err = cfg.LoopbackLogin(ctx, func(string) error { return nil })
+	assert.Equal(t, context.Canceled, err)
+}
@@ -1,14 +1,18 @@
 package oauth
 
 import (
-	"net/url"
+	"context"
 
+	beam "gitlab.com/toby3d/mixer"
 	oauth2 "golang.org/x/oauth2"
 )
 
 type (
 	Config struct {
 		*oauth2.Config
+
+		// ShortcodeURL is the endpoint of the shortcode flow.
+		ShortcodeURL string
 	}
 
 	Token struct {
@@ -16,38 +20,52 @@ type (
 	}
 )
 
+// NewClient returns a config of the production environment.
 func NewClient(clientID, clientSecret, redirectURI string, scopes ...string) *Config {
-	auth := &url.URL{
-		Scheme: "https",
-		Host:   "beam.pro",
-		Path:   "/oauth/authorize",
-	}
-
-	token := &url.URL{
-		Scheme: "https",
-		Host:   "beam.pro",
-		Path:   "/api/v1/oauth/token",
-	}
+	return NewEnvClient(beam.DefaultEnvironment, clientID, clientSecret, redirectURI, scopes...)
+}
 
+// NewEnvClient returns a config of the OAuth endpoints of the environment.
+func NewEnvClient(env *beam.Environment, clientID, clientSecret, redirectURI string, scopes ...string) *Config {
 	return &Config{
-		&oauth2.Config{
+		Config: &oauth2.Config{
 			RedirectURL:  redirectURI,
 			ClientID:     clientID,
 			ClientSecret: clientSecret,
 			Scopes:       scopes,
 			Endpoint: oauth2.Endpoint{
-				AuthURL:  auth.String(),
-				TokenURL: token.String(),
+				AuthURL:  env.AuthURL,
+				TokenURL: env.TokenURL,
+				// The token endpoint does not read the client credentials
+				// from the Authorization header.
+				AuthStyle: oauth2.AuthStyleInParams,
 			},
 		},
+		ShortcodeURL: env.ShortcodeURL,
 	}
 }
 
-func (cfg *Config) Exchange(code string) (*Token, error) {
-	oauth2.RegisterBrokenAuthHeaderProvider(cfg.Config.Endpoint.TokenURL)
-	token, err := cfg.Config.Exchange(oauth2.NoContext, code)
+// Exchange converts an authorization code into a token.
+func (cfg *Config) Exchange(ctx context.Context, code string, opts ...oauth2.AuthCodeOption) (*Token, error) {
+	token, err := cfg.Config.Exchange(ctx, code, opts...)
 	if err != nil {
 		return nil, err
 	}
 	return &Token{token}, nil
 }
+
+// Refresh gets a new token by the refresh token of the old one, even if the
+// old one is still valid.
+func (cfg *Config) Refresh(ctx context.Context, token *Token) (*Token, error) {
+	if token == nil || token.Token == nil || token.RefreshToken == "" {
+		return nil, ErrNoRefreshToken
+	}
+
+	// The source refreshes a token without an access token right away.
+	src := cfg.Config.TokenSource(ctx, &oauth2.Token{RefreshToken: token.RefreshToken})
+	fresh, err := src.Token()
+	if err != nil {
+		return nil, err
+	}
+	return &Token{fresh}, nil
+}
@@ -0,0 +1,128 @@
+package oauth
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	beam "gitlab.com/toby3d/mixer"
+	oauth2 "golang.org/x/oauth2"
+)
+
+// tokenServer issues access tokens numbered by the requests it got.
+func tokenServer(t *testing.T) (*httptest.Server, *int) {
+	var issued int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseForm())
+		assert.Equal(t, "id", r.PostForm.Get("client_id"))
+		assert.Equal(t, "secret", r.PostForm.Get("client_secret"))
+
+		switch r.PostForm.Get("grant_type") {
+		case "authorization_code":
+			assert.Equal(t, "code", r.PostForm.Get("code"))
+		case "refresh_token":
+			assert.Equal(t, "refresh", r.PostForm.Get("refresh_token"))
+		default:
+			t.Errorf("unexpected grant %q", r.PostForm.Get("grant_type"))
+		}
+
+		issued++
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"access` + strconv.Itoa(issued) + `","token_type":"Bearer","refresh_token":"refresh","expires_in":3600,"scope":"chat:connect chat:chat"}`))
+	}))
+
+	return srv, &issued
+}
+
+func testConfig(srv *httptest.Server) *Config {
+	env, _ := beam.HostEnvironment(srv.URL)
+	env.TokenURL = srv.URL
+	return NewEnvClient(env, "id", "secret", "http://localhost/callback")
+}
+
+func TestExchangeRefresh(t *testing.T) {
+	srv, _ := tokenServer(t)
+	defer srv.Close()
+	cfg := testConfig(srv)
+
+	token, err := cfg.Exchange(context.Background(), "code")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "access1", token.AccessToken)
+		assert.Equal(t, "refresh", token.RefreshToken)
+	}
+
+	token, err = cfg.Refresh(context.Background(), token)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "access2", token.AccessToken)
+	}
+
+	_, err = cfg.Refresh(context.Background(), &Token{&oauth2.Token{AccessToken: "x"}})
+	assert.Equal(t, ErrNoRefreshToken, err)
+}
+
+func TestTokenSource(t *testing.T) {
+	srv, issued := tokenServer(t)
+	defer srv.Close()
+	cfg := testConfig(srv)
+
+	store := NewMemoryStore(nil)
+	_, err := cfg.TokenSource(context.Background(), store)
+	assert.Equal(t, ErrNoToken, err)
+
+	assert.NoError(t, store.Save(&Token{&oauth2.Token{
+		AccessToken:  "expired",
+		RefreshToken: "refresh",
+		Expiry:       time.Now().Add(-time.Minute),
+	}}))
+	src, err := cfg.TokenSource(context.Background(), store)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	for i := 0; i < 2; i++ {
+		token, err := src.Token()
+		if assert.NoError(t, err) {
+			assert.Equal(t, "access1", token.AccessToken)
+		}
+	}
+	assert.Equal(t, 1, *issued)
+
+	saved, err := store.Load()
+	if assert.NoError(t, err) {
+		assert.Equal(t, "access1", saved.AccessToken)
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "oauth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store := NewFileStore(filepath.Join(dir, "token.json"))
+	_, err = store.Load()
+	assert.Equal(t, ErrNoToken, err)
+
+	expiry := time.Now().Add(time.Hour).Round(time.Second)
+	assert.NoError(t, store.Save(&Token{&oauth2.Token{AccessToken: "access", RefreshToken: "refresh", Expiry: expiry}}))
+
+	info, err := os.Stat(store.Path)
+	if assert.NoError(t, err) {
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	}
+
+	token, err := NewFileStore(store.Path).Load()
+	if assert.NoError(t, err) {
+		assert.Equal(t, "access", token.AccessToken)
+		assert.Equal(t, "refresh", token.RefreshToken)
+		assert.True(t, expiry.Equal(token.Expiry))
+	}
+}
@@ -0,0 +1,218 @@
+package oauth
+
+import (
+	"sort"
+	"strings"
+)
+
+type (
+	// ScopeSet is a set of known scopes. The zero value is an empty set.
+	ScopeSet map[string]struct{}
+
+	// MissingScopesError is returned by a check of scopes which lacks some of
+	// the required ones.
+	MissingScopesError struct {
+		Scopes ScopeSet
+	}
+
+	// UnknownScopeError is returned when parsing a scope which does not exist.
+	UnknownScopeError struct {
+		Scope string
+	}
+)
+
+// knownScopes are every scope defined in scopes.go.
+var knownScopes = ScopeSet{
+	ScopeAchievementsViewSelf:     {},
+	ScopeChannelAnalytics:         {},
+	ScopeChannelAnalyticsSelf:     {},
+	ScopeChannelCoStreamSelf:      {},
+	ScopeChannelDetailsSelf:       {},
+	ScopeChannelFollowSelf:        {},
+	ScopeChannelPartnership:       {},
+	ScopeChannelPartnershipSelf:   {},
+	ScopeChannelStreamKeySelf:     {},
+	ScopeChannelUpdateSelf:        {},
+	ScopeChatByPassLinks:          {},
+	ScopeChatByPassSlowChat:       {},
+	ScopeChatChangeBan:            {},
+	ScopeChatChangeRole:           {},
+	ScopeChat:                     {},
+	ScopeChatClearMessages:        {},
+	ScopeChatConnect:              {},
+	ScopeChatEditOptions:          {},
+	ScopeChatGiveawayStart:        {},
+	ScopeChatPollStart:            {},
+	ScopeChatPollVote:             {},
+	ScopeChatPurge:                {},
+	ScopeChatRemoveMessage:        {},
+	ScopeChatTimeout:              {},
+	ScopeChatViewDeleted:          {},
+	ScopeChatWhisper:              {},
+	ScopeInteractiveManageSelf:    {},
+	ScopeInteractiveRobotSelf:     {},
+	ScopeInvoiceSelf:              {},
+	ScopeLogViewSelf:              {},
+	ScopeNotificationUpdateSelf:   {},
+	ScopeNotificationViewSelf:     {},
+	ScopeRecordingManageSelf:      {},
+	ScopeRedeemableCreateSelf:     {},
+	ScopeRedeemableRedeemSelf:     {},
+	ScopeRedeemableViewSelf:       {},
+	ScopeResourceFindSelf:         {},
+	ScopeSubscriptionCancelSelf:   {},
+	ScopeSubscriptionCreateSelf:   {},
+	ScopeSubscriptionReNewSelf:    {},
+	ScopeSubscriptionViewSelf:     {},
+	ScopeTeamAdminister:           {},
+	ScopeTeamManageSelf:           {},
+	ScopeTransactionCancelSelf:    {},
+	ScopeTransactionViewSelf:      {},
+	ScopeUserAnalyticsSelf:        {},
+	ScopeUserDetailsSelf:          {},
+	ScopeUserGetDiscordInviteSelf: {},
+	ScopeUserLogSelf:              {},
+	ScopeUserNotificationSelf:     {},
+	ScopeUserSeenSelf:             {},
+	ScopeUserUpdateSelf:           {},
+	ScopeUserUpdatePasswordSelf:   {},
+}
+
+// ChatMethodScopes are the scopes needed by chat methods, by method name.
+// Methods which are not listed need no scope.
+var ChatMethodScopes = map[string][]string{
+	"auth":           {ScopeChatConnect},
+	"msg":            {ScopeChatConnect, ScopeChat},
+	"whisper":        {ScopeChatConnect, ScopeChatWhisper},
+	"vote:choose":    {ScopeChatConnect, ScopeChatPollVote},
+	"vote:start":     {ScopeChatConnect, ScopeChatPollStart},
+	"timeout":        {ScopeChatConnect, ScopeChatTimeout},
+	"purge":          {ScopeChatConnect, ScopeChatPurge},
+	"deleteMessage":  {ScopeChatConnect, ScopeChatRemoveMessage},
+	"clearMessages":  {ScopeChatConnect, ScopeChatClearMessages},
+	"giveaway:start": {ScopeChatConnect, ScopeChatGiveawayStart},
+}
+
+// OperationScopes are the scopes needed by REST operations, named by the
+// service and method of the client, like "Channels.UpdatePreferences".
+// Operations which are not listed need no scope.
+var OperationScopes = map[string][]string{
+	"Channels.UpdatePreferences": {ScopeChannelUpdateSelf},
+	"Invoices.Get":               {ScopeInvoiceSelf},
+	"Invoices.List":              {ScopeInvoiceSelf},
+	"Recordings.Delete":          {ScopeRecordingManageSelf},
+	"Recordings.MarkSeen":        {ScopeUserSeenSelf},
+}
+
+// ParseScopes parses the space separated scopes, like the scope of a token.
+func ParseScopes(scopes string) (ScopeSet, error) {
+	return NewScopeSet(strings.Fields(scopes)...)
+}
+
+// NewScopeSet returns a set of the scopes. It fails on the first unknown one.
+func NewScopeSet(scopes ...string) (ScopeSet, error) {
+	s := make(ScopeSet, len(scopes))
+	for _, scope := range scopes {
+		if _, ok := knownScopes[scope]; !ok {
+			return nil, &UnknownScopeError{Scope: scope}
+		}
+		s[scope] = struct{}{}
+	}
+
+	return s, nil
+}
+
+// Contains reports whether the set has every scope.
+func (s ScopeSet) Contains(scopes ...string) bool {
+	for _, scope := range scopes {
+		if _, ok := s[scope]; !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Union returns a set of the scopes of both sets.
+func (s ScopeSet) Union(other ScopeSet) ScopeSet {
+	union := make(ScopeSet, len(s)+len(other))
+	for scope := range s {
+		union[scope] = struct{}{}
+	}
+	for scope := range other {
+		union[scope] = struct{}{}
+	}
+
+	return union
+}
+
+// Missing returns the scopes which are required but not in the set.
+func (s ScopeSet) Missing(required ...string) ScopeSet {
+	missing := make(ScopeSet)
+	for _, scope := range required {
+		if _, ok := s[scope]; !ok {
+			missing[scope] = struct{}{}
+		}
+	}
+
+	return missing
+}
+
+// Slice returns the scopes in order, like the scopes taken by NewClient.
+func (s ScopeSet) Slice() []string {
+	scopes := make([]string, 0, len(s))
+	for scope := range s {
+		scopes = append(scopes, scope)
+	}
+	sort.Strings(scopes)
+
+	return scopes
+}
+
+// String returns the space separated scopes in order.
+func (s ScopeSet) String() string {
+	return strings.Join(s.Slice(), " ")
+}
+
+// CheckChat returns a *MissingScopesError if the set lacks a scope needed by
+// the chat method.
+func (s ScopeSet) CheckChat(method string) error {
+	return s.check(ChatMethodScopes[method])
+}
+
+// CheckOperation returns a *MissingScopesError if the set lacks a scope
+// needed by the REST operation.
+func (s ScopeSet) CheckOperation(operation string) error {
+	return s.check(OperationScopes[operation])
+}
+
+func (s ScopeSet) check(required []string) error {
+	if missing := s.Missing(required...); len(missing) > 0 {
+		return &MissingScopesError{Scopes: missing}
+	}
+
+	return nil
+}
+
+// Error implements the error interface.
+func (e *MissingScopesError) Error() string {
+	return "oauth: missing " + e.Scopes.String()
+}
+
+// Error implements the error interface.
+func (e *UnknownScopeError) Error() string {
+	return "oauth: unknown scope " + e.Scope
+}
+
+// ScopeSet returns the set of the scopes asked by the config, failing on the
+// unknown ones.
+func (cfg *Config) ScopeSet() (ScopeSet, error) {
+	return NewScopeSet(cfg.Scopes...)
+}
+
+// Scopes returns the set of the scopes granted to the token, sent by the
+// server with the token.
+func (t *Token) Scopes() (ScopeSet, error) {
+	scope, _ := t.Extra("scope").(string)
+	return ParseScopes(scope)
+}
@@ -0,0 +1,68 @@
+package oauth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScopeSet(t *testing.T) {
+	s, err := ParseScopes(" chat:connect  chat:chat ")
+	assert.NoError(t, err)
+	assert.True(t, s.Contains(ScopeChat, ScopeChatConnect))
+	assert.False(t, s.Contains(ScopeChat, ScopeChatTimeout))
+	assert.Equal(t, "chat:chat chat:connect", s.String())
+
+	_, err = ParseScopes("chat:chat chat:fly")
+	if uerr, ok := err.(*UnknownScopeError); assert.True(t, ok, "%v", err) {
+		assert.Equal(t, "chat:fly", uerr.Scope)
+	}
+
+	other, _ := NewScopeSet(ScopeChatTimeout, ScopeChat)
+	union := s.Union(other)
+	assert.Equal(t, []string{ScopeChat, ScopeChatConnect, ScopeChatTimeout}, union.Slice())
+	assert.Len(t, s, 2)
+
+	assert.Equal(t, []string{ScopeChatTimeout}, s.Missing(ScopeChat, ScopeChatTimeout).Slice())
+	assert.Empty(t, ScopeSet(nil).Missing())
+}
+
+func TestScopeChecks(t *testing.T) {
+	s, _ := NewScopeSet(ScopeChatConnect, ScopeChat)
+	assert.NoError(t, s.CheckChat("msg"))
+	assert.NoError(t, s.CheckChat("ping"))
+	assert.EqualError(t, s.CheckChat("timeout"), "oauth: missing chat:timeout")
+
+	assert.NoError(t, s.CheckOperation("Channels.Get"))
+	err := s.CheckOperation("Recordings.Delete")
+	if merr, ok := err.(*MissingScopesError); assert.True(t, ok, "%v", err) {
+		assert.True(t, merr.Scopes.Contains(ScopeRecordingManageSelf))
+	}
+
+	// Every scope of the tables is known.
+	for _, table := range []map[string][]string{ChatMethodScopes, OperationScopes} {
+		for name, scopes := range table {
+			_, err := NewScopeSet(scopes...)
+			assert.NoError(t, err, name)
+		}
+	}
+}
+
+func TestTokenScopes(t *testing.T) {
+	srv, _ := tokenServer(t)
+	defer srv.Close()
+	cfg := testConfig(srv)
+
+	token, err := cfg.Exchange(context.Background(), "code")
+	if !assert.NoError(t, err) {
+		return
+	}
+	s, err := token.Scopes()
+	assert.NoError(t, err)
+	assert.Equal(t, "chat:chat chat:connect", s.String())
+
+	cfg.Scopes = []string{ScopeChat, "chat"}
+	_, err = cfg.ScopeSet()
+	assert.Error(t, err)
+}
@@ -0,0 +1,168 @@
+package oauth
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	ffjson "github.com/pquerna/ffjson/ffjson"
+	oauth2 "golang.org/x/oauth2"
+)
+
+// DefaultShortcodeInterval is the time between checks of a shortcode.
+const DefaultShortcodeInterval = 2 * time.Second
+
+var (
+	// ErrShortcodeDenied is returned when the user denied the access.
+	ErrShortcodeDenied = errors.New("oauth: shortcode denied")
+
+	// ErrShortcodeExpired is returned when the user did not enter the
+	// shortcode in time.
+	ErrShortcodeExpired = errors.New("oauth: shortcode expired")
+)
+
+// Shortcode is a 6 character code which the user enters at beam.pro/go to
+// authorize a client without a browser, like a bot on a server.
+type Shortcode struct {
+	Code   string `json:"code"`
+	Handle string `json:"handle"`
+
+	// ExpiresIn is the number of seconds the code is valid for.
+	ExpiresIn int `json:"expires_in"`
+
+	// Expiry is the time the code expires at, set by Config.Shortcode.
+	Expiry time.Time `json:"-"`
+
+	// Interval is the time between checks of the code,
+	// DefaultShortcodeInterval by default.
+	Interval time.Duration `json:"-"`
+}
+
+// Shortcode requests a new shortcode for the scopes of the config. Show its
+// code to the user and call WaitShortcode to get the token.
+func (cfg *Config) Shortcode(ctx context.Context) (*Shortcode, error) {
+	body, err := ffjson.Marshal(map[string]string{
+		"client_id":     cfg.ClientID,
+		"client_secret": cfg.ClientSecret,
+		"scope":         strings.Join(cfg.Scopes, " "),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, cfg.ShortcodeURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClient(ctx).Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("oauth: shortcode request failed: %s", resp.Status)
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	sc := new(Shortcode)
+	if err := ffjson.Unmarshal(data, sc); err != nil {
+		return nil, err
+	}
+	sc.Expiry = time.Now().Add(time.Duration(sc.ExpiresIn) * time.Second)
+	sc.Interval = DefaultShortcodeInterval
+
+	return sc, nil
+}
+
+// WaitShortcode checks the shortcode until the user approves it and exchanges
+// the authorization code for a token. It returns ErrShortcodeDenied or
+// ErrShortcodeExpired if the user did not approve it.
+func (cfg *Config) WaitShortcode(ctx context.Context, sc *Shortcode) (*Token, error) {
+	interval := sc.Interval
+	if interval <= 0 {
+		interval = DefaultShortcodeInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		code, err := cfg.checkShortcode(ctx, sc)
+		if err != nil {
+			return nil, err
+		}
+		if code != "" {
+			return cfg.Exchange(ctx, code)
+		}
+		if !sc.Expiry.IsZero() && time.Now().After(sc.Expiry) {
+			return nil, ErrShortcodeExpired
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// checkShortcode returns the authorization code of an approved shortcode, or
+// an empty code while the user did not answer yet.
+func (cfg *Config) checkShortcode(ctx context.Context, sc *Shortcode) (string, error) {
+	req, err := http.NewRequest(http.MethodGet, cfg.ShortcodeURL+"/check/"+sc.Handle, nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := httpClient(ctx).Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		data, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return "", err
+		}
+
+		var result struct {
+			Code string `json:"code"`
+		}
+		if err := ffjson.Unmarshal(data, &result); err != nil {
+			return "", err
+		}
+		return result.Code, nil
+	case http.StatusNoContent:
+		return "", nil
+	case http.StatusForbidden:
+		return "", ErrShortcodeDenied
+	case http.StatusNotFound:
+		return "", ErrShortcodeExpired
+	}
+
+	return "", fmt.Errorf("oauth: shortcode check failed: %s", resp.Status)
+}
+
+// httpClient returns the client set in the context by oauth2.HTTPClient, like
+// the token requests of oauth2 do.
+func httpClient(ctx context.Context) *http.Client {
+	if client, ok := ctx.Value(oauth2.HTTPClient).(*http.Client); ok {
+		return client
+	}
+
+	return http.DefaultClient
+}
@@ -0,0 +1,102 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// shortcodeServer answers the checks of handle with the statuses in order,
+// then approves it with the code "code".
+func shortcodeServer(t *testing.T, statuses ...int) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/shortcode", func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, "id", body["client_id"])
+		assert.Equal(t, "chat:connect chat:chat", body["scope"])
+		w.Write([]byte(`{"code":"ABC123","handle":"handle","expires_in":120}`))
+	})
+	mux.HandleFunc("/shortcode/check/handle", func(w http.ResponseWriter, r *http.Request) {
+		if len(statuses) > 0 {
+			w.WriteHeader(statuses[0])
+			statuses = statuses[1:]
+			return
+		}
+		w.Write([]byte(`{"code":"code"}`))
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseForm())
+		assert.Equal(t, "code", r.PostForm.Get("code"))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"access","token_type":"Bearer","refresh_token":"refresh","expires_in":3600}`))
+	})
+
+	return httptest.NewServer(mux)
+}
+
+func shortcodeConfig(srv *httptest.Server) *Config {
+	cfg := NewClient("id", "secret", "", ScopeChatConnect, ScopeChat)
+	cfg.Endpoint.TokenURL = srv.URL + "/token"
+	cfg.ShortcodeURL = srv.URL + "/shortcode"
+	return cfg
+}
+
+func TestShortcode(t *testing.T) {
+	srv := shortcodeServer(t, http.StatusNoContent, http.StatusNoContent)
+	defer srv.Close()
+	cfg := shortcodeConfig(srv)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	sc, err := cfg.Shortcode(ctx)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "ABC123", sc.Code)
+	assert.Equal(t, "handle", sc.Handle)
+	assert.WithinDuration(t, time.Now().Add(2*time.Minute), sc.Expiry, time.Second)
+
+	sc.Interval = time.Millisecond
+	token, err := cfg.WaitShortcode(ctx, sc)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "access", token.AccessToken)
+		assert.Equal(t, "refresh", token.RefreshToken)
+	}
+}
+
+func TestShortcodeErrors(t *testing.T) {
+	for status, want := range map[int]error{
+		http.StatusForbidden: ErrShortcodeDenied,
+		http.StatusNotFound:  ErrShortcodeExpired,
+	} {
+		srv := shortcodeServer(t, http.StatusNoContent, status)
+		_, err := shortcodeConfig(srv).WaitShortcode(context.Background(), &Shortcode{Handle: "handle", Interval: time.Millisecond})
+		assert.Equal(t, want, err)
+		srv.Close()
+	}
+
+	srv := shortcodeServer(t, http.StatusNoContent, http.StatusNoContent)
+	defer srv.Close()
+	cfg := shortcodeConfig(srv)
+
+	// The code expires locally even if the server keeps it pending.
+	_, err := cfg.WaitShortcode(context.Background(), &Shortcode{
+		Handle:   "handle",
+		Expiry:   time.Now().Add(-time.Second),
+		Interval: time.Millisecond,
+	})
+	assert.Equal(t, ErrShortcodeExpired, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = cfg.WaitShortcode(ctx, &Shortcode{Handle: "handle", Interval: time.Hour})
+	assert.True(t, err == context.Canceled || strings.Contains(err.Error(), context.Canceled.Error()), "%v", err)
+}
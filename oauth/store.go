@@ -0,0 +1,122 @@
+package oauth
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	ffjson "github.com/pquerna/ffjson/ffjson"
+	oauth2 "golang.org/x/oauth2"
+)
+
+type (
+	// TokenStore keeps a token between runs. Load returns ErrNoToken if no
+	// token was saved yet.
+	TokenStore interface {
+		Load() (*Token, error)
+		Save(*Token) error
+	}
+
+	// FileStore keeps a token as JSON in a file, which only the owner may
+	// read.
+	FileStore struct {
+		Path string
+
+		mu sync.Mutex
+	}
+
+	// MemoryStore keeps a token for the life of the process.
+	MemoryStore struct {
+		mu    sync.Mutex
+		token *oauth2.Token
+	}
+)
+
+// NewFileStore returns a store of the file at path.
+func NewFileStore(path string) *FileStore {
+	return &FileStore{Path: path}
+}
+
+// Load reads the token from the file.
+func (s *FileStore) Load() (*Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := ioutil.ReadFile(s.Path)
+	if os.IsNotExist(err) {
+		return nil, ErrNoToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	token := new(oauth2.Token)
+	if err := ffjson.Unmarshal(data, token); err != nil {
+		return nil, err
+	}
+	return &Token{token}, nil
+}
+
+// Save writes the token to a temporary file and moves it over the old one, so
+// the file is never left half written.
+func (s *FileStore) Save(token *Token) error {
+	data, err := ffjson.Marshal(token.Token)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tmp, err := ioutil.TempFile(filepath.Dir(s.Path), filepath.Base(s.Path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.Path)
+}
+
+// NewMemoryStore returns a store of the token, which may be nil.
+func NewMemoryStore(token *Token) *MemoryStore {
+	s := new(MemoryStore)
+	if token != nil {
+		s.token = token.Token
+	}
+	return s
+}
+
+// Load returns a copy of the token.
+func (s *MemoryStore) Load() (*Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token == nil {
+		return nil, ErrNoToken
+	}
+	token := *s.token
+	return &Token{&token}, nil
+}
+
+// Save keeps a copy of the token.
+func (s *MemoryStore) Save(token *Token) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	copied := *token.Token
+	s.token = &copied
+	return nil
+}
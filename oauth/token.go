@@ -0,0 +1,78 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+
+	oauth2 "golang.org/x/oauth2"
+)
+
+var (
+	// ErrNoToken is returned by a TokenStore which has no token saved.
+	ErrNoToken = errors.New("oauth: no token")
+
+	// ErrNoRefreshToken is returned when an expired token can not be
+	// refreshed.
+	ErrNoRefreshToken = errors.New("oauth: no refresh token")
+)
+
+// TokenSource returns a valid token, refreshing it once it expires. Every new
+// token is saved to the store, so the refresh token survives restarts. It is
+// safe for concurrent use and implements oauth2.TokenSource.
+type TokenSource struct {
+	cfg   *Config
+	ctx   context.Context
+	store TokenStore
+
+	mu    sync.Mutex
+	token *Token
+}
+
+// TokenSource returns a source of the token saved in the store. The context
+// is used for the refresh requests and must live as long as the source.
+func (cfg *Config) TokenSource(ctx context.Context, store TokenStore) (*TokenSource, error) {
+	token, err := store.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenSource{
+		cfg:   cfg,
+		ctx:   ctx,
+		store: store,
+		token: token,
+	}, nil
+}
+
+// Client returns an HTTP client which authorizes requests by the tokens of
+// the source, like the one taken by beam.NewClient.
+func (cfg *Config) Client(ctx context.Context, src *TokenSource) *http.Client {
+	return oauth2.NewClient(ctx, src)
+}
+
+// Token returns the current token, refreshed first if it expired.
+func (src *TokenSource) Token() (*oauth2.Token, error) {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+
+	if src.token.Valid() {
+		return src.token.Token, nil
+	}
+
+	token, err := src.cfg.Refresh(src.ctx, src.token)
+	if err != nil {
+		return nil, err
+	}
+	// The server may keep the refresh token the same without sending it.
+	if token.RefreshToken == "" {
+		token.RefreshToken = src.token.RefreshToken
+	}
+	if err := src.store.Save(token); err != nil {
+		return nil, err
+	}
+	src.token = token
+
+	return token.Token, nil
+}
@@ -0,0 +1,44 @@
+package beam
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// RecordingsService handles communication with the recording related methods
+// of the API.
+type RecordingsService service
+
+// Get returns a recording by ID.
+func (s *RecordingsService) Get(ctx context.Context, recordingID uint) (*Recording, error) {
+	var recording Recording
+	if err := s.client.get(ctx, fmt.Sprintf("recordings/%d", recordingID), &recording); err != nil {
+		return nil, err
+	}
+
+	return &recording, nil
+}
+
+// Delete deletes a recording, requires the recording:manage:self scope.
+func (s *RecordingsService) Delete(ctx context.Context, recordingID uint) error {
+	req, err := s.client.NewRequest(http.MethodDelete, fmt.Sprintf("recordings/%d", recordingID), nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.client.Do(ctx, req, nil)
+	return err
+}
+
+// MarkSeen marks a recording as seen by the authenticated user, requires the
+// user:seen:self scope.
+func (s *RecordingsService) MarkSeen(ctx context.Context, recordingID uint) error {
+	req, err := s.client.NewRequest(http.MethodPost, fmt.Sprintf("recordings/%d/seen", recordingID), nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.client.Do(ctx, req, nil)
+	return err
+}
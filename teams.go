@@ -0,0 +1,41 @@
+package beam
+
+import (
+	"context"
+	"fmt"
+)
+
+// TeamsService handles communication with the team related methods of the
+// API.
+type TeamsService service
+
+// Get returns a team by its ID or token.
+func (s *TeamsService) Get(ctx context.Context, idOrToken string) (*Team, error) {
+	var team Team
+	if err := s.client.get(ctx, "teams/"+idOrToken, &team); err != nil {
+		return nil, err
+	}
+
+	return &team, nil
+}
+
+// List returns a list of teams.
+func (s *TeamsService) List(ctx context.Context, opts *ListOptions) ([]Team, error) {
+	var teams []Team
+	if err := s.client.get(ctx, withQuery("teams", opts.values()), &teams); err != nil {
+		return nil, err
+	}
+
+	return teams, nil
+}
+
+// Users returns the members of the team.
+func (s *TeamsService) Users(ctx context.Context, teamID uint, opts *ListOptions) ([]User, error) {
+	var users []User
+	path := withQuery(fmt.Sprintf("teams/%d/users", teamID), opts.values())
+	if err := s.client.get(ctx, path, &users); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
@@ -0,0 +1,64 @@
+package beam
+
+import (
+	"context"
+	"fmt"
+)
+
+// UsersService handles communication with the user related methods of the
+// API.
+type UsersService service
+
+// Get returns a user by ID.
+func (s *UsersService) Get(ctx context.Context, userID uint) (*User, error) {
+	var user User
+	if err := s.client.get(ctx, fmt.Sprintf("users/%d", userID), &user); err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// Current returns the authenticated user, requires an OAuth client.
+func (s *UsersService) Current(ctx context.Context) (*User, error) {
+	var user User
+	if err := s.client.get(ctx, "users/current", &user); err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// Search returns the users whose username starts with query.
+func (s *UsersService) Search(ctx context.Context, query string, opts *ListOptions) ([]User, error) {
+	var users []User
+	q := opts.values()
+	q.Set("query", query)
+	path := withQuery("users/search", q)
+	if err := s.client.get(ctx, path, &users); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// Follows returns the channels followed by the user.
+func (s *UsersService) Follows(ctx context.Context, userID uint, opts *ListOptions) ([]Channel, error) {
+	var channels []Channel
+	path := withQuery(fmt.Sprintf("users/%d/follows", userID), opts.values())
+	if err := s.client.get(ctx, path, &channels); err != nil {
+		return nil, err
+	}
+
+	return channels, nil
+}
+
+// Teams returns the teams the user is a member of.
+func (s *UsersService) Teams(ctx context.Context, userID uint) ([]Team, error) {
+	var teams []Team
+	if err := s.client.get(ctx, fmt.Sprintf("users/%d/teams", userID), &teams); err != nil {
+		return nil, err
+	}
+
+	return teams, nil
+}